@@ -0,0 +1,351 @@
+// Copyright 2019 John Darrington johnw.darrington@gmail.com
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package bifrost
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// unixPrefix marks a ControlAddr as the path of a Unix socket rather than a host and port
+const unixPrefix = "unix:"
+
+// PidFile is written to heimdall's working directory while it serves the control API, holding heimdall's pid on its
+// first line and the API's address on its second. The status, logs, kill and scale commands find the API through it.
+const PidFile = "heimdall.pid"
+
+// controlServer serves the control API on a single address for every execution attached to it
+type controlServer struct {
+	addr   string
+	server *http.Server
+
+	lock     sync.Mutex
+	controls []*control
+}
+
+// controlServers holds the control API served on every address, so executions sharing an address, such as a
+// pipeline's jobs, are controlled through the same API
+var controlServers = struct {
+	lock    sync.Mutex
+	servers map[string]*controlServer
+}{servers: map[string]*controlServer{}}
+
+// serveControl attaches an execution's control to the control API served on addr, listening on it first when
+// nothing is served there yet. The returned function detaches it again, the listener being closed once nothing is
+// attached. Nothing is served for an empty address.
+//
+// The API speaks json -
+//
+//	GET  /status                          every execution, whether it's paused, its parallelism and running instances
+//	GET  /instances                       the running instances with their PID, uptime and repetition
+//	GET  /instances/{instance}/output     an instance's latest lines of output, ?lines= limiting how many and
+//	                                      ?after= skipping those up to a line's Seq
+//	POST /instances/{instance}/kill       kill an instance's running run
+//	POST /instances/{instance}/restart    kill an instance's running run and start it again
+//	POST /pause                           hold back runs about to start, running runs are left to finish
+//	POST /resume                          start held back runs
+//	POST /scale?parallel=                 change how many runs may run at once
+//
+// Every endpoint takes ?job= to only address the execution of a single pipeline job.
+func serveControl(addr string, c *control) (func(), error) {
+	if addr == "" {
+		return func() {}, nil
+	}
+
+	controlServers.lock.Lock()
+	defer controlServers.lock.Unlock()
+
+	server, ok := controlServers.servers[addr]
+	if !ok {
+		listener, err := listenControl(addr)
+		if err != nil {
+			return nil, fmt.Errorf("serving the control API: %s", err)
+		}
+
+		server = &controlServer{addr: addr}
+		server.server = &http.Server{Handler: server.handler()}
+		go server.server.Serve(listener)
+
+		writePidFile(listener)
+
+		controlServers.servers[addr] = server
+	}
+
+	server.lock.Lock()
+	server.controls = append(server.controls, c)
+	server.lock.Unlock()
+
+	return func() { server.detach(c) }, nil
+}
+
+// listenControl listens on a loopback host and port, or on a Unix socket replacing one left behind by a heimdall which
+// is gone
+func listenControl(addr string) (net.Listener, error) {
+	if !strings.HasPrefix(addr, unixPrefix) {
+		local, err := loopbackAddr(addr)
+		if err != nil {
+			return nil, err
+		}
+
+		return net.Listen("tcp", local)
+	}
+
+	path := strings.TrimPrefix(addr, unixPrefix)
+	if _, err := os.Stat(path); err == nil {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("%s is in use by another heimdall", path)
+		}
+
+		os.Remove(path)
+	}
+
+	return net.Listen("unix", path)
+}
+
+// loopbackAddr makes sure a host and port is only reachable from this machine, as the control API lets anyone
+// reaching it kill runs. A missing host listens on 127.0.0.1 rather than every interface.
+func loopbackAddr(addr string) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", err
+	}
+
+	switch ip := net.ParseIP(host); {
+	case host == "":
+		host = "127.0.0.1"
+	case host == "localhost":
+	case ip == nil || !ip.IsLoopback():
+		return "", fmt.Errorf("%s isn't a loopback address, serve the control API on one or on a unix: socket", host)
+	}
+
+	return net.JoinHostPort(host, port), nil
+}
+
+func (s *controlServer) detach(c *control) {
+	controlServers.lock.Lock()
+	defer controlServers.lock.Unlock()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for i, attached := range s.controls {
+		if attached == c {
+			s.controls = append(s.controls[:i], s.controls[i+1:]...)
+			break
+		}
+	}
+
+	if len(s.controls) == 0 {
+		// closing a Unix listener removes its socket as well, clients still connected are cut off
+		s.server.Close()
+		delete(controlServers.servers, s.addr)
+
+		removePidFile()
+	}
+}
+
+// writePidFile writes the PidFile for a control API listening on listener, only warning when it can't be written
+// as the API can still be reached directly
+func writePidFile(listener net.Listener) {
+	addr := listener.Addr().String()
+	if listener.Addr().Network() == "unix" {
+		path, _ := filepath.Abs(addr)
+		addr = unixPrefix + path
+	}
+
+	content := fmt.Sprintf("%d\n%s\n", os.Getpid(), addr)
+	if err := ioutil.WriteFile(PidFile, []byte(content), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "heimdall: writing %s: %s\n", PidFile, err)
+	}
+}
+
+// removePidFile removes the PidFile unless another heimdall has written its own since
+func removePidFile() {
+	content, err := ioutil.ReadFile(PidFile)
+	if err != nil {
+		return
+	}
+
+	if pid, _, _ := strings.Cut(string(content), "\n"); pid == strconv.Itoa(os.Getpid()) {
+		os.Remove(PidFile)
+	}
+}
+
+// selected returns the attached executions a request addresses
+func (s *controlServer) selected(r *http.Request) ([]*control, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	job := r.URL.Query().Get("job")
+	if job == "" {
+		return append([]*control{}, s.controls...), nil
+	}
+
+	for _, c := range s.controls {
+		if c.name == job {
+			return []*control{c}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no job named %q is running", job)
+}
+
+func (s *controlServer) handler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /status", s.handle(func(controls []*control, r *http.Request) (interface{}, int, error) {
+		return statuses(controls), http.StatusOK, nil
+	}))
+
+	mux.HandleFunc("GET /instances", s.handle(func(controls []*control, r *http.Request) (interface{}, int, error) {
+		instances := []instanceStatus{}
+		for _, c := range controls {
+			instances = append(instances, c.instances()...)
+		}
+
+		return instances, http.StatusOK, nil
+	}))
+
+	mux.HandleFunc("GET /instances/{instance}/output", s.handle(func(controls []*control, r *http.Request) (interface{}, int, error) {
+		instance, err := strconv.Atoi(r.PathValue("instance"))
+		if err != nil {
+			return nil, http.StatusBadRequest, fmt.Errorf("invalid instance: %s", err)
+		}
+
+		count, after := 0, 0
+		if lines := r.URL.Query().Get("lines"); lines != "" {
+			if count, err = strconv.Atoi(lines); err != nil {
+				return nil, http.StatusBadRequest, fmt.Errorf("invalid lines: %s", err)
+			}
+		}
+
+		if seq := r.URL.Query().Get("after"); seq != "" {
+			if after, err = strconv.Atoi(seq); err != nil {
+				return nil, http.StatusBadRequest, fmt.Errorf("invalid after: %s", err)
+			}
+		}
+
+		output := []outputLine{}
+		for _, c := range controls {
+			output = append(output, c.recent(instance, count, after)...)
+		}
+
+		return output, http.StatusOK, nil
+	}))
+
+	kill := func(restart bool) func(controls []*control, r *http.Request) (interface{}, int, error) {
+		return func(controls []*control, r *http.Request) (interface{}, int, error) {
+			instance, err := strconv.Atoi(r.PathValue("instance"))
+			if err != nil {
+				return nil, http.StatusBadRequest, fmt.Errorf("invalid instance: %s", err)
+			}
+
+			killed := 0
+			for _, c := range controls {
+				killed += c.kill(instance, restart)
+			}
+
+			if killed == 0 {
+				return nil, http.StatusNotFound, fmt.Errorf("instance %d isn't running", instance)
+			}
+
+			return statuses(controls), http.StatusOK, nil
+		}
+	}
+
+	mux.HandleFunc("POST /instances/{instance}/kill", s.handle(kill(false)))
+	mux.HandleFunc("POST /instances/{instance}/restart", s.handle(kill(true)))
+
+	mux.HandleFunc("POST /pause", s.handle(func(controls []*control, r *http.Request) (interface{}, int, error) {
+		for _, c := range controls {
+			c.pause()
+		}
+
+		return statuses(controls), http.StatusOK, nil
+	}))
+
+	mux.HandleFunc("POST /resume", s.handle(func(controls []*control, r *http.Request) (interface{}, int, error) {
+		for _, c := range controls {
+			c.resume()
+		}
+
+		return statuses(controls), http.StatusOK, nil
+	}))
+
+	mux.HandleFunc("POST /scale", s.handle(func(controls []*control, r *http.Request) (interface{}, int, error) {
+		parallel, err := strconv.Atoi(r.URL.Query().Get("parallel"))
+		if err != nil {
+			return nil, http.StatusBadRequest, fmt.Errorf("invalid parallel: %s", err)
+		}
+
+		for _, c := range controls {
+			if err := c.scale(parallel); errors.Is(err, errScaleRamped) {
+				return nil, http.StatusConflict, err
+			} else if err != nil {
+				return nil, http.StatusBadRequest, err
+			}
+		}
+
+		return statuses(controls), http.StatusOK, nil
+	}))
+
+	return mux
+}
+
+// handle turns an endpoint into a handler, writing what it returns as json
+func (s *controlServer) handle(endpoint func(controls []*control, r *http.Request) (interface{}, int, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		controls, err := s.selected(r)
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(apiError{Error: err.Error()})
+			return
+		}
+
+		body, status, err := endpoint(controls, r)
+		if err != nil {
+			body = apiError{Error: err.Error()}
+		}
+
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(body)
+	}
+}
+
+// apiError is the body of a failed control API request
+type apiError struct {
+	Error string
+}
+
+func statuses(controls []*control) []jobStatus {
+	out := make([]jobStatus, len(controls))
+	for i, c := range controls {
+		out[i] = c.status()
+	}
+
+	return out
+}
@@ -21,17 +21,26 @@ package bifrost
 
 import (
 	"bufio"
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"regexp"
 	"sync"
+	"sync/atomic"
+	"text/template"
 	"time"
 )
 
 // ManagerConfig manages configuration for the bifrost execution function
 type ManagerConfig struct {
-	AbsolutePath     string
+	AbsolutePath string
+	// ProgramArguments may contain Go templates rendered for every run, e.g "--port={{add 8000 .Instance}}" or
+	// "--out=run-{{.RunID}}.csv". Instance, Repetition, RunID and a matrix cell's Params are available along with the
+	// add, sub, mul and mod functions.
 	ProgramArguments []string
 
 	Timeout       time.Duration `json:"-"`
@@ -46,118 +55,735 @@ type ManagerConfig struct {
 	LogFilter    *regexp.Regexp
 	Verbose      bool
 
-	logFile *os.File
-	lock    *sync.Mutex
-	wg      sync.WaitGroup
+	DetectDivergence bool
+
+	// Only one source of stdin may be set. StdinTemplate is a file path rendered for every run, e.g
+	// "input-{{.Repetition}}.txt". StdinParent feeds heimdall's own stdin to the program as it arrives, see StdinFanOut
+	// and StdinRoundRobin. All of it is kept for the runs started later, so an endless stream grows heimdall's memory.
+	StdinString   string
+	StdinFile     string
+	StdinTemplate string
+	StdinParent   string
+
+	// Env entries are in KEY=VALUE form and are added to, or override, heimdall's own environment. UnsetEnv removes
+	// variables by name and CleanEnv starts the program with an empty environment instead. HEIMDALL_INSTANCE,
+	// HEIMDALL_REPETITION and HEIMDALL_RUN_ID are always set.
+	Env        []string
+	UnsetEnv   []string
+	CleanEnv   bool
+	WorkingDir string
+
+	// Matrix turns the execution into a parameter sweep, Repeat then applies to every cell of the matrix and
+	// InParallelCount is the amount of workers the cells are spread across
+	Matrix *Matrix
+
+	// ShellCommand is run through Shell instead of executing AbsolutePath, allowing pipelines and compound commands
+	// such as "make build && ./bin/tool". It is rendered as a template like ProgramArguments, which follow it as the
+	// command's "$1", "$2" and so on. Shell defaults to "sh -c", or "cmd /C" on Windows.
+	ShellCommand string
+	Shell        string
+
+	// Hooks are shell commands run before and after all runs, and before and after each run
+	Hooks HookConfig
+
+	// DependsOn names the jobs which must succeed before this job runs when several jobs are run as a pipeline
+	DependsOn []string
+
+	// ReportName is the path of a json report holding the summary and every run's result, no report is written
+	// when empty
+	ReportName string
+
+	// MetricsAddr is the address Prometheus metrics are served on at /metrics while heimdall runs - e.g ":9090",
+	// nothing is served when empty
+	MetricsAddr string
+
+	// ControlAddr is the address the control API is served on while heimdall runs, preferably a Unix socket as "unix:"
+	// followed by its path - e.g "unix:heimdall.sock". A host and port must be a loopback one, a missing host meaning
+	// 127.0.0.1. Nothing is served when empty.
+	ControlAddr string
+
+	// Schedule runs the program periodically instead of back to back, see ScheduleConfig
+	Schedule ScheduleConfig
+
+	// For and Until turn the execution into a soak, the program is repeated back to back until the deadline - For
+	// after the first run, or the RFC 3339 timestamp Until, whichever comes first - instead of Repeat times. A
+	// schedule stops triggering at the deadline. OnDeadline decides what happens to runs still going at the
+	// deadline, see DeadlineFinish and DeadlineKill.
+	For        string
+	Until      string
+	OnDeadline string
+
+	// Ramp starts instances gradually rather than all at once, see RampConfig
+	Ramp RampConfig
+
+	// Rate starts this many runs per second whether or not earlier runs have finished, rather than starting a run
+	// whenever an instance is free. InParallelCount caps how many run at once, a run due while every instance is
+	// busy is missed rather than delayed.
+	Rate float64
+
+	// Thresholds fail runs which used more memory or CPU time than allowed, see ThresholdConfig
+	Thresholds ThresholdConfig
+
+	// Limits constrain the resources of every run's process, see LimitConfig
+	Limits LimitConfig
+
+	// Sampling samples every running process's resources from /proc while it runs, see SamplingConfig
+	Sampling SamplingConfig
+
+	// Watch configures the paths heimdall watch restarts the program on changes to, see WatchConfig
+	Watch WatchConfig
 }
 
+// Normalize fills the fields configuration files can't hold directly, such as Timeout, from their string
+// counterparts. An empty LogFilter is dropped as it would filter nothing.
+func (config *ManagerConfig) Normalize() error {
+	if config.TimeoutString != "" {
+		timeout, err := time.ParseDuration(config.TimeoutString)
+		if err != nil {
+			return &FieldError{Field: "TimeoutString", Err: err}
+		}
+
+		config.Timeout = timeout
+	}
+
+	if config.LogFilter != nil && config.LogFilter.String() == "" {
+		config.LogFilter = nil
+	}
+
+	return nil
+}
+
+// manager holds the state shared by every worker during a single execution
+type manager struct {
+	config ManagerConfig
+
+	logFile    *os.File
+	lock       *sync.Mutex
+	divergence *divergence
+	stdin      *stdinSource
+	arguments  []*template.Template
+
+	// program and programArguments are what is executed for every run, see commandLine
+	program          string
+	programArguments []string
+
+	summary    *summary
+	hooks      *hooks
+	thresholds *thresholds
+	limits     *limits
+	sampling   *sampling
+	metrics    *metrics
+	control    *control
+
+	// runs counts every run started so far and is used to hand out run IDs
+	runs int64
+
+	// ramp limits how many instances run at once over time, nil when every instance starts straight away
+	ramp *ramp
+
+	// rate is the time between runs started at a target rate, zero when runs are started as soon as an instance
+	// is free
+	rate time.Duration
+
+	// stop is closed once a soak's deadline has passed and no more runs may be started, it is nil otherwise
+	stop <-chan struct{}
+}
+
+// runInfo identifies a single run of the managed program and is the data available to templates rendered per run
+type runInfo struct {
+	Instance   int
+	Repetition int
+	RunID      int
+
+	// Cell names the run's matrix cell and Params holds its values, both are empty without a matrix
+	Cell   string            `json:",omitempty"`
+	Params map[string]string `json:",omitempty"`
+
+	// Concurrency is how many instances a ramp allowed to run at once when the run started, zero without a ramp
+	Concurrency int `json:",omitempty"`
+}
+
+func (r runInfo) String() string {
+	if r.Cell != "" {
+		return fmt.Sprintf("run %d (instance %d repetition %d %s)", r.RunID, r.Instance, r.Repetition, r.Cell)
+	}
+
+	return fmt.Sprintf("run %d (instance %d repetition %d)", r.RunID, r.Instance, r.Repetition)
+}
+
+// ErrRunsFailed is returned by Execute when any run of the program failed. A pipeline fails on the same condition,
+// see ExecutePipeline.
+var ErrRunsFailed = errors.New("one or more runs failed")
+
 // Execute accepts a configuration and attempts to run the provided program and its arguments.
 func Execute(config ManagerConfig) error {
-	return execute(config)
+	summary, err := execute(context.Background(), "", config)
+	if err != nil {
+		return err
+	}
+
+	if summary.failed() {
+		return ErrRunsFailed
+	}
+
+	return nil
 }
 
-func execute(config ManagerConfig) error {
-	config.lock = &sync.Mutex{}
-	config.wg = sync.WaitGroup{}
+// execute runs the program as configured and returns the summary of every run. Name labels the summary when the
+// execution is one of several jobs. Runs still going once ctx is done are killed and no more are started.
+func execute(ctx context.Context, name string, config ManagerConfig) (*summary, error) {
+	m := &manager{config: config, lock: &sync.Mutex{}}
+
+	if err := ValidateEnv(config.Env); err != nil {
+		return nil, err
+	}
 
 	if config.Log && config.LogOverwrite {
 		f, err := os.Create(config.LogName)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		defer f.Close()
 
-		config.logFile = f
+		m.logFile = f
 	} else if config.Log {
 		f, err := os.OpenFile(config.LogName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		defer f.Close()
 
-		config.logFile = f
+		m.logFile = f
 	}
 
-	for p := 0; p < config.InParallelCount; p++ {
-		config.wg.Add(1)
+	if config.DetectDivergence {
+		m.divergence = newDivergence()
+	}
 
-		go func() {
-			for i := 0; i < config.Repeat; i++ {
-				command := exec.Command(config.AbsolutePath, config.ProgramArguments...)
+	stdin, err := newStdinSource(config, os.Stdin)
+	if err != nil {
+		return nil, err
+	}
 
-				// attachment of reader/writers to command execution
-				stdoutDone, stderrDone := attachLogger(command, config)
+	m.stdin = stdin
 
-				if err := command.Start(); err != nil {
-					//return err
-				}
+	m.program, m.programArguments = commandLine(config)
 
-				if config.Timeout > 0 {
-					time.AfterFunc(config.Timeout, func() {
-						command.Process.Kill()
-					})
-				}
+	m.arguments, err = argumentTemplates(m.programArguments)
+	if err != nil {
+		return nil, err
+	}
 
-				if err := command.Wait(); err != nil {
-					//	return err
-				}
+	if err := config.Matrix.validate(); err != nil {
+		return nil, err
+	}
 
-				// we're not going to wait on these to finish if we don't need them. Helps us avoid infinite loops if we somehow
-				// screwed up the reader/write initiation
-				if config.LogFilter != nil || config.Log || config.Verbose {
-					<-stdoutDone
-					<-stderrDone
-				}
+	trigger, err := newTrigger(config)
+	if err != nil {
+		return nil, err
+	}
+
+	soaking, err := newSoak(config)
+	if err != nil {
+		return nil, err
+	}
+
+	m.ramp, err = newRamp(config)
+	if err != nil {
+		return nil, err
+	}
+
+	m.rate, err = rateInterval(config)
+	if err != nil {
+		return nil, err
+	}
+
+	m.thresholds, err = newThresholds(config)
+	if err != nil {
+		return nil, err
+	}
 
+	m.limits, err = newLimits(config)
+	if err != nil {
+		return nil, err
+	}
+
+	m.sampling, err = newSampling(config)
+	if err != nil {
+		return nil, err
+	}
+
+	// a ramp through stages lasts as long as they do unless it is part of a soak
+	if m.ramp != nil && soaking == nil && m.ramp.length() > 0 {
+		soaking = &soak{length: m.ramp.length(), kill: config.OnDeadline == DeadlineKill}
+	}
+
+	if config.ReportName != "" {
+		if err := checkReportPath(config.ReportName); err != nil {
+			return nil, err
+		}
+	}
+
+	m.metrics, err = serveMetrics(config.MetricsAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	m.control = newControl(name, config, m.ramp != nil)
+
+	detach, err := serveControl(config.ControlAddr, m.control)
+	if err != nil {
+		return nil, err
+	}
+
+	defer detach()
+
+	m.hooks, err = newHooks(config)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.hooks.runBeforeAll(); err != nil {
+		return nil, err
+	}
+
+	m.limits.enable()
+
+	cells := config.Matrix.cells()
+	m.summary = newSummary(cells, config.ReportName != "")
+
+	if m.ramp != nil {
+		m.summary.levels = map[int]*cellSummary{}
+	}
+
+	if m.rate > 0 {
+		m.summary.rate = &rateSummary{Target: config.Rate}
+	}
+
+	// besides ctx, runs are only killed when a soak's deadline passes and its policy says so
+	var deadline time.Time
+	if soaking != nil {
+		deadline = soaking.deadline(time.Now())
+
+		if soaking.kill {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithDeadline(ctx, deadline)
+			defer cancel()
+		}
+	}
+
+	switch {
+	case trigger != nil:
+		if soaking != nil {
+			stop, cancel := context.WithDeadline(ctx, deadline)
+			defer cancel()
+
+			m.stop = stop.Done()
+		}
+
+		trigger.until = deadline
+		m.runScheduled(ctx, trigger, cells)
+	case soaking != nil:
+		m.runSoak(ctx, deadline, cells)
+	default:
+		queue := make(chan runSpec)
+		go m.schedule(queue, cells)
+
+		m.runWorkers(ctx, queue)
+	}
+
+	if soaking != nil {
+		m.summary.finishSoak()
+	}
+
+	if m.divergence != nil {
+		m.divergence.report(os.Stdout)
+	}
+
+	m.summary.print(os.Stdout, name)
+
+	if config.ReportName != "" {
+		if err := m.summary.writeReport(config.ReportName); err != nil {
+			return m.summary, err
+		}
+	}
+
+	return m.summary, m.hooks.runAfterAll(m.summary)
+}
+
+// runSpec is a run waiting in the queue for a free worker
+type runSpec struct {
+	repetition int
+	cell       matrixCell
+}
+
+// schedule queues every run making up the execution, closing the queue once done. Each matrix cell is run Repeat
+// times. Without a matrix each parallel instance runs Repeat times, as if every instance had its own cell.
+func (m *manager) schedule(queue chan<- runSpec, cells []matrixCell) {
+	for i := 0; i < m.config.Repeat; i++ {
+		for _, cell := range cells {
+			for c := 0; c < m.copies(); c++ {
+				queue <- runSpec{repetition: i, cell: cell}
 			}
+		}
+	}
 
-			config.wg.Done()
+	close(queue)
+}
+
+// copies is how many times every cell runs in a single repetition
+func (m *manager) copies() int {
+	if m.config.Matrix == nil {
+		return m.control.parallelism()
+	}
+
+	return 1
+}
+
+// dispatchTick is how often a dispatcher waiting for a free instance checks whether the parallelism has changed
+const dispatchTick = 50 * time.Millisecond
+
+// runWorkers runs every queued run, at most as many at once as the parallelism allows, returning once the queue is
+// closed and every run has finished. Runs still queued once ctx is done are dropped.
+func (m *manager) runWorkers(ctx context.Context, queue <-chan runSpec) {
+	if m.ramp != nil {
+		m.runRamped(ctx, queue)
+		return
+	}
+
+	if m.rate > 0 {
+		m.runAtRate(ctx, m.rate, queue)
+		return
+	}
+
+	m.dispatch(ctx, queue, m.control.parallelism)
+}
+
+// dispatch starts every queued run on the lowest free instance as soon as fewer runs are going than level allows.
+// Level may change while runs are going, it is checked again whenever an instance is freed and every dispatchTick.
+func (m *manager) dispatch(ctx context.Context, queue <-chan runSpec, level func() int) {
+	wg := sync.WaitGroup{}
+	slots := newInstanceSlots()
+
+	ticker := time.NewTicker(dispatchTick)
+	defer ticker.Stop()
+
+	for spec := range queue {
+		current := level()
+
+		for slots.active() >= current && !m.stopped(ctx) {
+			select {
+			case <-slots.released:
+			case <-ticker.C:
+			case <-ctx.Done():
+			case <-m.stop:
+			}
+
+			current = level()
+		}
+
+		// runs still queued once no more may be started are dropped
+		if m.stopped(ctx) {
+			continue
+		}
+
+		run := m.newRun(slots.take(), spec)
+		if m.ramp != nil {
+			run.Concurrency = current
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			m.runOnce(ctx, run)
+			slots.release(run.Instance)
 		}()
+	}
+
+	wg.Wait()
+}
 
+// stopped reports whether no more runs may be started, either because ctx is done or a soak's deadline has passed
+func (m *manager) stopped(ctx context.Context) bool {
+	select {
+	case <-m.stop:
+		return true
+	default:
+		return ctx.Err() != nil
 	}
+}
 
-	config.wg.Wait()
+// newRun describes the next run of the managed program, handing out run IDs in the order runs are started
+func (m *manager) newRun(instance int, spec runSpec) runInfo {
+	return runInfo{
+		Instance:   instance,
+		Repetition: spec.repetition,
+		RunID:      int(atomic.AddInt64(&m.runs, 1)),
+		Cell:       spec.cell.Name,
+		Params:     spec.cell.Params,
+	}
+}
 
-	return nil
+// runOnce runs the managed program a single time along with the hooks surrounding it and records the result. The
+// run waits while the execution is paused and is dropped if no more runs may be started by then. A run killed to be
+// restarted is recorded, then run again under a new run ID.
+func (m *manager) runOnce(ctx context.Context, run runInfo) {
+	for {
+		if !m.control.wait(ctx, m.stop) {
+			return
+		}
+
+		if err := m.hooks.runBeforeEach(run); err != nil {
+			result := runResult{runInfo: run, Started: time.Now(), Error: runError(run, err)}
+			m.metrics.runFinished(result)
+			m.summary.record(result)
+			return
+		}
+
+		result := m.runProgram(ctx, run)
+		m.metrics.runFinished(result)
+
+		if err := m.hooks.runAfterEach(result); err != nil {
+			runError(run, err)
+		}
+
+		m.summary.record(result)
+
+		if !result.restart || m.stopped(ctx) {
+			return
+		}
+
+		m.metrics.restarted()
+		run.RunID = int(atomic.AddInt64(&m.runs, 1))
+	}
+}
+
+// outputDrain is how long a run's output is still read once its program exited, for output its children hold open
+const outputDrain = 500 * time.Millisecond
+
+// runProgram starts the managed program a single time and waits for both it and its output to finish. The program
+// is killed if ctx is done before it exits.
+func (m *manager) runProgram(ctx context.Context, run runInfo) (result runResult) {
+	config := m.config
+	result = runResult{runInfo: run, Started: time.Now()}
+
+	// the control API may kill a single run without ending the execution
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	arguments, err := renderArguments(m.programArguments, m.arguments, run)
+	if err != nil {
+		result.Error = runError(run, err)
+		return
+	}
+
+	command := exec.CommandContext(ctx, m.program, arguments...)
+	command.Env = environment(config, run)
+	command.Dir = config.WorkingDir
+
+	stdin, closer, err := m.stdin.open(run)
+	if err != nil {
+		result.Error = runError(run, err)
+		return
+	}
+
+	if closer != nil {
+		defer closer.Close()
+	}
+
+	command.Stdin = stdin
+
+	limited, err := m.limits.prepare(command, run)
+	if err != nil {
+		result.Error = runError(run, err)
+		return
+	}
+
+	defer limited.close()
+
+	// stdout is only captured when we need to compare it against the other runs
+	var captured *bytes.Buffer
+	if m.divergence != nil {
+		captured = &bytes.Buffer{}
+	}
+
+	// attachment of reader/writers to command execution
+	// output is only read once the program started, as each line is prefixed with its PID
+	started := make(chan struct{})
+	stdoutDone, stderrDone, closeOutput := attachLogger(command, m, run, captured, started)
+
+	// output held open by processes the program started, such as a backgrounded child, is only drained for a little
+	// while once the program exits so they can't keep the run going
+	command.WaitDelay = outputDrain
+
+	err = command.Start()
+	close(started)
+
+	if err != nil {
+		closeOutput()
+		result.Error = runError(run, err)
+		return
+	}
+
+	m.metrics.runStarted()
+	m.control.started(run, command.Process.Pid, cancel)
+	sampler := m.sampling.start(command.Process.Pid, limited.cgroupPath())
+	memory := trackPeakMemory(command.Process.Pid)
+
+	var timedOut int32
+	if config.Timeout > 0 {
+		timer := time.AfterFunc(config.Timeout, func() {
+			atomic.StoreInt32(&timedOut, 1)
+			command.Process.Kill()
+		})
+
+		defer timer.Stop()
+	}
+
+	command.Wait()
+	closeOutput()
+
+	<-stdoutDone
+	<-stderrDone
+
+	result.Samples = sampler.stop()
+
+	peak := memory.stop()
+	if cgroupPeak := limited.peakMemory(); cgroupPeak > 0 {
+		peak = cgroupPeak
+	}
+
+	result.restart = m.control.exited(run)
+
+	result.duration = time.Since(result.Started)
+	result.ExitCode = command.ProcessState.ExitCode()
+	result.TimedOut = atomic.LoadInt32(&timedOut) == 1
+	result.Killed = ctx.Err() != nil && !result.TimedOut
+	m.metrics.runExited(result.duration, result.TimedOut)
+
+	result.Usage = newUsage(command.ProcessState, peak)
+	result.OverThreshold = m.thresholds.check(result.Usage)
+	result.Limit = limited.finished(command.ProcessState)
+	result.MemoryGrowth = m.sampling.grew(result.Samples)
+
+	m.logUsage(command, result)
+
+	if captured != nil {
+		m.divergence.record(run, captured.String())
+	}
+
+	return result
+}
+
+// logUsage logs the resources a run used along with its outcome, alongside the program's output. The report
+// and summary hold them whether or not the line is logged.
+func (m *manager) logUsage(cmd *exec.Cmd, result runResult) {
+	if !m.config.Log && !m.config.Verbose {
+		return
+	}
+
+	line := fmt.Sprintf("heimdall: exit code %d in %s, %s", result.ExitCode, result.duration.Round(time.Millisecond), result.Usage)
+	if result.Limit != "" {
+		line += ", " + result.Limit
+	}
+
+	if result.OverThreshold != "" {
+		line += ", failed as " + result.OverThreshold
+	}
+
+	if result.MemoryGrowth != "" {
+		line += ", " + result.MemoryGrowth
+	}
+
+	out := logLine(cmd, result.runInfo, line+"\n")
+
+	if m.config.Verbose {
+		os.Stdout.Write([]byte(out))
+	}
+
+	// like the program's output, the line only makes it into a filtered log when it matches the filter
+	if m.config.Log && (m.config.LogFilter == nil || m.config.LogFilter.MatchString(line)) {
+		m.lock.Lock()
+		m.logFile.Write([]byte(out))
+		m.lock.Unlock()
+	}
+}
+
+// runError lets the user know a run could not be started, the remaining runs carry on regardless. The error's text
+// is returned for the run's result.
+func runError(run runInfo, err error) string {
+	fmt.Fprintf(os.Stderr, "heimdall: %s: %s\n", run, err)
+	return err.Error()
 }
 
-func attachLogger(cmd *exec.Cmd, config ManagerConfig) (stdoutDone chan interface{}, stderrDone chan interface{}) {
+// logLine prefixes a line of output with the program's PID, the time and the run's matrix parameters if any
+func logLine(cmd *exec.Cmd, run runInfo, line string) string {
+	if run.Cell != "" {
+		return fmt.Sprintf("[H-PID:%d %s %s]  %s", cmd.Process.Pid, time.Now().UTC().Format("06-01-02 15:04:05"), run.Cell, line)
+	}
+
+	return fmt.Sprintf("[H-PID:%d %s]  %s", cmd.Process.Pid, time.Now().UTC().Format("06-01-02 15:04:05"), line)
+}
+
+// attachLogger wires the command's output to the console and log file as the configuration demands, once started is
+// closed. If capture is not nil the command's stdout is also copied into it. closeOutput must be called once the
+// command was waited on, or failed to start, for the done channels to be closed.
+func attachLogger(cmd *exec.Cmd, m *manager, run runInfo, capture *bytes.Buffer, started <-chan struct{}) (stdoutDone chan interface{}, stderrDone chan interface{}, closeOutput func()) {
+	config := m.config
+
 	stdoutDone = make(chan interface{})
 	stderrDone = make(chan interface{})
 
-	stdout, _ := cmd.StdoutPipe()
-	stderr, _ := cmd.StderrPipe()
+	// the command copies its output into the pipes itself, Wait returning once it's all copied or WaitDelay passed
+	stdout, stdoutWriter := io.Pipe()
+	stderr, stderrWriter := io.Pipe()
+	cmd.Stdout = stdoutWriter
+	cmd.Stderr = stderrWriter
+
+	closeOutput = func() {
+		stdoutWriter.Close()
+		stderrWriter.Close()
+	}
 
 	// while we could make a single function and simply assign the output writer, I choose to keep stdout and stderr
 	// separate for ease of reading and understanding by those new to Go.
 	go func() {
+		<-started
 		rd := bufio.NewReader(stdout)
 
 		for {
 			str, err := rd.ReadString('\n')
+			if capture != nil {
+				capture.WriteString(str)
+			}
+
 			if err != nil {
 				break
 			}
 
-			out := fmt.Sprintf("[H-PID:%d %s]  %s", cmd.Process.Pid, time.Now().UTC().Format("06-01-02 15:04:05"), str)
+			out := logLine(cmd, run, str)
+			matched := config.LogFilter != nil && config.LogFilter.MatchString(str)
+			m.metrics.output("stdout", str, matched)
+			m.control.record(run, "stdout", str)
 
 			if config.Verbose {
 				os.Stdout.Write([]byte(out))
 			}
 
 			if config.LogFilter != nil {
-				if config.LogFilter.MatchString(str) {
-					config.lock.Lock()
-					config.logFile.Write([]byte(out))
-					config.lock.Unlock()
+				if matched {
+					m.lock.Lock()
+					m.logFile.Write([]byte(out))
+					m.lock.Unlock()
 				}
 
 			} else if config.Log {
-				config.lock.Lock()
-				config.logFile.Write([]byte(out))
-				config.lock.Unlock()
+				m.lock.Lock()
+				m.logFile.Write([]byte(out))
+				m.lock.Unlock()
 			}
 
 		}
@@ -165,6 +791,7 @@ func attachLogger(cmd *exec.Cmd, config ManagerConfig) (stdoutDone chan interfac
 	}()
 
 	go func() {
+		<-started
 		rd := bufio.NewReader(stderr)
 
 		for {
@@ -173,28 +800,31 @@ func attachLogger(cmd *exec.Cmd, config ManagerConfig) (stdoutDone chan interfac
 				break
 			}
 
-			out := fmt.Sprintf("[H-PID:%d %s]  %s", cmd.Process.Pid, time.Now().UTC().Format("06-01-02 15:04:05"), str)
+			out := logLine(cmd, run, str)
+			matched := config.LogFilter != nil && config.LogFilter.MatchString(str)
+			m.metrics.output("stderr", str, matched)
+			m.control.record(run, "stderr", str)
 
 			if config.Verbose {
 				os.Stdout.Write([]byte(out))
 			}
 
 			if config.LogFilter != nil {
-				if config.LogFilter.MatchString(str) {
-					config.lock.Lock()
-					config.logFile.Write([]byte(out))
-					config.lock.Unlock()
+				if matched {
+					m.lock.Lock()
+					m.logFile.Write([]byte(out))
+					m.lock.Unlock()
 				}
 
 			} else if config.Log {
-				config.lock.Lock()
-				config.logFile.Write([]byte(out))
-				config.lock.Unlock()
+				m.lock.Lock()
+				m.logFile.Write([]byte(out))
+				m.lock.Unlock()
 			}
 		}
 
 		close(stderrDone)
 	}()
 
-	return stdoutDone, stderrDone
+	return stdoutDone, stderrDone, closeOutput
 }
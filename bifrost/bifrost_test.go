@@ -2,7 +2,9 @@ package bifrost
 
 import (
 	"bufio"
+	"context"
 	"fmt"
+	"io/ioutil"
 	"os/exec"
 	"path/filepath"
 	"testing"
@@ -70,3 +72,40 @@ func TestBifrostLogging(t *testing.T) {
 	err = hProcess.Wait()
 	assert.Nil(t, err)
 }
+
+func TestBifrostBackgroundedChild(t *testing.T) {
+	logName := filepath.Join(t.TempDir(), "heimdall.log")
+
+	// the backgrounded sleep holds the program's output open long after the program exited
+	timer := time.Now()
+	summary, err := execute(context.Background(), "", ManagerConfig{
+		AbsolutePath:     "/bin/sh",
+		ProgramArguments: []string{"-c", "echo before; sleep 5 & echo after"},
+		Repeat:           1,
+		InParallelCount:  1,
+		Log:              true,
+		LogName:          logName,
+	})
+	assert.Nil(t, err)
+
+	assert.True(t, time.Since(timer) < 3*time.Second)
+	assert.Equal(t, 1, summary.total.Succeeded)
+
+	content, _ := ioutil.ReadFile(logName)
+	assert.Contains(t, string(content), "before\n")
+	assert.Contains(t, string(content), "after\n")
+
+	// nor can a pipeline outlive the timeout through the processes it started
+	timer = time.Now()
+	summary, err = execute(context.Background(), "", ManagerConfig{
+		AbsolutePath:     "/bin/sh",
+		ProgramArguments: []string{"-c", "sleep 5 | cat"},
+		Timeout:          time.Second,
+		Repeat:           1,
+		InParallelCount:  1,
+	})
+	assert.Nil(t, err)
+
+	assert.True(t, time.Since(timer) < 3*time.Second)
+	assert.Equal(t, 1, summary.total.TimedOut)
+}
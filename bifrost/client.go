@@ -0,0 +1,229 @@
+// Copyright 2019 John Darrington johnw.darrington@gmail.com
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package bifrost
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// followInterval is how often new output is asked for when following an instance's output
+const followInterval = 500 * time.Millisecond
+
+// Controller talks to the control API of a heimdall running in the current directory, see FindController. Job
+// addresses a single job of a pipeline, every job is addressed when empty.
+type Controller struct {
+	PID  int
+	Addr string
+	Job  string
+
+	client *http.Client
+}
+
+// FindController finds the heimdall running in the current directory through its PidFile
+func FindController() (*Controller, error) {
+	content, err := ioutil.ReadFile(PidFile)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no %s in the current directory, start heimdall with --controlAddr to control it", PidFile)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if len(lines) != 2 {
+		return nil, fmt.Errorf("%s is malformed, expected a pid and an address", PidFile)
+	}
+
+	pid, err := strconv.Atoi(lines[0])
+	if err != nil {
+		return nil, fmt.Errorf("%s is malformed: %s", PidFile, err)
+	}
+
+	c := &Controller{PID: pid, Addr: lines[1], client: &http.Client{Timeout: 10 * time.Second}}
+
+	if strings.HasPrefix(c.Addr, unixPrefix) {
+		socket := strings.TrimPrefix(c.Addr, unixPrefix)
+		c.client.Transport = &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+			},
+		}
+	}
+
+	return c, nil
+}
+
+// call calls an endpoint of the control API, decoding its json response into out
+func (c *Controller) call(method, path string, query url.Values, out interface{}) error {
+	if c.Job != "" {
+		query.Set("job", c.Job)
+	}
+
+	host := c.Addr
+	if strings.HasPrefix(host, unixPrefix) {
+		host = "heimdall"
+	}
+
+	request, err := http.NewRequest(method, "http://"+host+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+
+	response, err := c.client.Do(request)
+	if err != nil {
+		return fmt.Errorf("heimdall %d isn't answering on %s, remove %s if it exited: %s", c.PID, c.Addr, PidFile, err)
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		failed := apiError{}
+		if err := json.NewDecoder(response.Body).Decode(&failed); err != nil || failed.Error == "" {
+			return fmt.Errorf("heimdall answered %s", response.Status)
+		}
+
+		return errors.New(failed.Error)
+	}
+
+	return json.NewDecoder(response.Body).Decode(out)
+}
+
+// Status writes whether the running heimdall is paused, its parallelism and every running instance
+func (c *Controller) Status(w io.Writer) error {
+	var statuses []jobStatus
+	if err := c.call("GET", "/status", url.Values{}, &statuses); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "heimdall %d on %s\n", c.PID, c.Addr)
+
+	for _, status := range statuses {
+		state := "running"
+		if status.Paused {
+			state = "paused"
+		}
+
+		if status.Job != "" {
+			fmt.Fprintf(w, "\njob %s: ", status.Job)
+		}
+
+		fmt.Fprintf(w, "%s, parallelism %d, %d instance(s) running\n", state, status.Parallelism, len(status.Instances))
+
+		if len(status.Instances) == 0 {
+			continue
+		}
+
+		table := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(table, "INSTANCE\tRUN\tREPETITION\tPID\tUPTIME\tCELL")
+
+		for _, instance := range status.Instances {
+			fmt.Fprintf(table, "%d\t%d\t%d\t%d\t%s\t%s\n", instance.Instance, instance.RunID, instance.Repetition,
+				instance.PID, roundDuration(instance.UptimeSeconds), instance.Cell)
+		}
+
+		table.Flush()
+	}
+
+	return nil
+}
+
+// Logs writes an instance's latest lines of output, stdout to w and stderr to errW, every line kept when lines isn't
+// positive. With follow set new output keeps being written until the running heimdall exits.
+func (c *Controller) Logs(w, errW io.Writer, instance, lines int, follow bool) error {
+	path := fmt.Sprintf("/instances/%d/output", instance)
+	query := url.Values{}
+
+	if lines > 0 {
+		query.Set("lines", strconv.Itoa(lines))
+	}
+
+	after := 0
+
+	for polled := false; ; polled = true {
+		var output []outputLine
+		if err := c.call("GET", path, query, &output); err != nil {
+			// following ends with the heimdall being followed
+			if polled {
+				fmt.Fprintln(errW, "heimdall: the running heimdall exited")
+				return nil
+			}
+
+			return err
+		}
+
+		for _, line := range output {
+			out := w
+			if line.Stream == "stderr" {
+				out = errW
+			}
+
+			fmt.Fprintln(out, line.Line)
+			after = line.Seq
+		}
+
+		if !follow {
+			return nil
+		}
+
+		// only the latest lines are limited, every line since is followed
+		query.Del("lines")
+		query.Set("after", strconv.Itoa(after))
+
+		time.Sleep(followInterval)
+	}
+}
+
+// Kill kills an instance's running run, starting it again when restart is set
+func (c *Controller) Kill(w io.Writer, instance int, restart bool) error {
+	action, done := "kill", "killed"
+	if restart {
+		action, done = "restart", "restarted"
+	}
+
+	var statuses []jobStatus
+	if err := c.call("POST", fmt.Sprintf("/instances/%d/%s", instance, action), url.Values{}, &statuses); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "heimdall: instance %d %s\n", instance, done)
+
+	return nil
+}
+
+// Scale changes how many runs the running heimdall may run at once
+func (c *Controller) Scale(w io.Writer, parallel int) error {
+	var statuses []jobStatus
+	if err := c.call("POST", "/scale", url.Values{"parallel": {strconv.Itoa(parallel)}}, &statuses); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "heimdall: parallelism is now %d\n", parallel)
+
+	return nil
+}
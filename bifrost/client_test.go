@@ -0,0 +1,91 @@
+package bifrost
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestController(t *testing.T) {
+	dir, _ := filepath.EvalSymlinks(t.TempDir())
+
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	os.Chdir(dir)
+
+	_, err := FindController()
+	assert.NotNil(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		_, err := execute(context.Background(), "", ManagerConfig{
+			AbsolutePath:     "/bin/sh",
+			ProgramArguments: []string{"-c", "echo out; echo err >&2; exec sleep 10"},
+			Repeat:           1,
+			InParallelCount:  1,
+			ControlAddr:      unixPrefix + "heimdall.sock",
+		})
+		assert.Nil(t, err)
+	}()
+
+	var c *Controller
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+
+	// the program is running once its output shows
+	for i := 0; i < 100 && stderr.Len() == 0; i++ {
+		time.Sleep(50 * time.Millisecond)
+
+		if c, err = FindController(); err == nil {
+			stdout.Reset()
+			stderr.Reset()
+			c.Logs(stdout, stderr, 0, 0, false)
+		}
+	}
+
+	if !assert.NotNil(t, c) {
+		return
+	}
+
+	assert.Equal(t, "out\n", stdout.String())
+	assert.Equal(t, "err\n", stderr.String())
+
+	status := &bytes.Buffer{}
+	assert.Nil(t, c.Status(status))
+	assert.Contains(t, status.String(), fmt.Sprintf("heimdall %d on unix:%s\n", os.Getpid(), filepath.Join(dir, "heimdall.sock")))
+	assert.Contains(t, status.String(), "running, parallelism 1, 1 instance(s) running\n")
+
+	assert.NotNil(t, c.Scale(status, 0))
+	assert.Nil(t, c.Scale(status, 1))
+	assert.NotNil(t, c.Kill(status, 3, false))
+
+	followed := make(chan error)
+	followOut, followErr := &bytes.Buffer{}, &bytes.Buffer{}
+	go func() {
+		followed <- c.Logs(followOut, followErr, 0, 0, true)
+	}()
+
+	time.Sleep(followInterval / 2)
+	assert.Nil(t, c.Kill(status, 0, false))
+
+	select {
+	case err := <-followed:
+		assert.Nil(t, err)
+		assert.Equal(t, "out\n", followOut.String())
+		assert.Equal(t, "err\nheimdall: the running heimdall exited\n", followErr.String())
+	case <-time.After(5 * time.Second):
+		t.Fatal("following didn't end once heimdall was done")
+	}
+
+	<-done
+
+	_, err = os.Stat(PidFile)
+	assert.True(t, os.IsNotExist(err))
+}
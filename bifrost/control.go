@@ -0,0 +1,318 @@
+// Copyright 2019 John Darrington johnw.darrington@gmail.com
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package bifrost
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// outputLines is how many of an instance's latest lines of output are kept for the control API
+const outputLines = 200
+
+// errScaleRamped is returned when scaling an execution whose concurrency a ramp decides
+var errScaleRamped = errors.New("parallelism follows the ramp and can't be changed")
+
+// outputLine is a line a run wrote to stdout or stderr. Seq numbers every line of an execution in the order they
+// were written.
+type outputLine struct {
+	Seq    int
+	RunID  int
+	Stream string
+	Line   string
+}
+
+// liveRun is a run whose program is running
+type liveRun struct {
+	run     runInfo
+	pid     int
+	started time.Time
+	cancel  context.CancelFunc
+
+	// restart is set once the run was killed to be started again
+	restart bool
+}
+
+// instanceStatus describes a running run for the control API
+type instanceStatus struct {
+	Job string `json:",omitempty"`
+	runInfo
+
+	PID           int
+	Started       time.Time
+	UptimeSeconds float64
+}
+
+// jobStatus describes an execution for the control API
+type jobStatus struct {
+	Job         string `json:",omitempty"`
+	Paused      bool
+	Parallelism int
+	Instances   []instanceStatus
+}
+
+// control is the live state of an execution - the runs whose programs are running, their recent output, whether
+// starting runs is paused and how many may run at once. The control API reads and changes it while the execution
+// runs.
+type control struct {
+	name   string
+	ramped bool
+
+	lock     sync.Mutex
+	live     map[int]*liveRun
+	output   map[int][]outputLine
+	parallel int
+	paused   bool
+	seq      int
+
+	// resumed is closed when a paused execution is resumed
+	resumed chan struct{}
+}
+
+func newControl(name string, config ManagerConfig, ramped bool) *control {
+	return &control{
+		name:     name,
+		ramped:   ramped,
+		live:     map[int]*liveRun{},
+		output:   map[int][]outputLine{},
+		parallel: config.InParallelCount,
+	}
+}
+
+// parallelism is how many runs may run at once
+func (c *control) parallelism() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.parallel
+}
+
+// scale changes how many runs may run at once. Running runs are left to finish when scaling down.
+func (c *control) scale(parallel int) error {
+	if c.ramped {
+		return errScaleRamped
+	}
+
+	if parallel < 1 {
+		return errors.New("parallelism must be at least 1")
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.parallel = parallel
+
+	return nil
+}
+
+// pause holds back runs about to start until resumed, running runs are left to finish
+func (c *control) pause() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if !c.paused {
+		c.paused = true
+		c.resumed = make(chan struct{})
+	}
+}
+
+func (c *control) resume() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.paused {
+		c.paused = false
+		close(c.resumed)
+	}
+}
+
+// wait blocks while the execution is paused, returning false when ctx is done or stop closed first
+func (c *control) wait(ctx context.Context, stop <-chan struct{}) bool {
+	c.lock.Lock()
+	paused, resumed := c.paused, c.resumed
+	c.lock.Unlock()
+
+	if !paused {
+		return true
+	}
+
+	select {
+	case <-resumed:
+		return c.wait(ctx, stop)
+	case <-ctx.Done():
+		return false
+	case <-stop:
+		return false
+	}
+}
+
+// started tracks a run whose program was started, cancel killing it
+func (c *control) started(run runInfo, pid int, cancel context.CancelFunc) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.live[run.RunID] = &liveRun{run: run, pid: pid, started: time.Now(), cancel: cancel}
+}
+
+// exited stops tracking a run whose program exited, reporting whether it must be started again
+func (c *control) exited(run runInfo) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	live := c.live[run.RunID]
+	delete(c.live, run.RunID)
+
+	return live != nil && live.restart
+}
+
+// record keeps a line of a run's output, dropping the instance's oldest line once outputLines are kept
+func (c *control) record(run runInfo, stream, line string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.seq++
+
+	lines := append(c.output[run.Instance], outputLine{Seq: c.seq, RunID: run.RunID, Stream: stream, Line: strings.TrimRight(line, "\r\n")})
+	if len(lines) > outputLines {
+		lines = lines[len(lines)-outputLines:]
+	}
+
+	c.output[run.Instance] = lines
+}
+
+// recent returns up to count of an instance's latest lines of output numbered past after, every such line kept when
+// count isn't positive
+func (c *control) recent(instance, count, after int) []outputLine {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	lines := c.output[instance]
+	for len(lines) > 0 && lines[0].Seq <= after {
+		lines = lines[1:]
+	}
+
+	if count > 0 && count < len(lines) {
+		lines = lines[len(lines)-count:]
+	}
+
+	return append([]outputLine{}, lines...)
+}
+
+// kill kills every running run of an instance, starting each again when restart is set. The number of runs killed
+// is returned.
+func (c *control) kill(instance int, restart bool) int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	killed := 0
+	for _, live := range c.live {
+		if live.run.Instance != instance {
+			continue
+		}
+
+		live.restart = restart
+		live.cancel()
+		killed++
+	}
+
+	return killed
+}
+
+// instances describes every running run, ordered by instance
+func (c *control) instances() []instanceStatus {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	instances := []instanceStatus{}
+	for _, live := range c.live {
+		instances = append(instances, instanceStatus{
+			Job:           c.name,
+			runInfo:       live.run,
+			PID:           live.pid,
+			Started:       live.started,
+			UptimeSeconds: time.Since(live.started).Seconds(),
+		})
+	}
+
+	sort.Slice(instances, func(i, j int) bool {
+		if instances[i].Instance != instances[j].Instance {
+			return instances[i].Instance < instances[j].Instance
+		}
+
+		return instances[i].RunID < instances[j].RunID
+	})
+
+	return instances
+}
+
+func (c *control) status() jobStatus {
+	instances := c.instances()
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return jobStatus{Job: c.name, Paused: c.paused, Parallelism: c.parallel, Instances: instances}
+}
+
+// instanceSlots hands out instance numbers to runs being started, the lowest one free first
+type instanceSlots struct {
+	lock sync.Mutex
+	busy map[int]bool
+
+	// released is signalled whenever an instance is freed
+	released chan struct{}
+}
+
+func newInstanceSlots() *instanceSlots {
+	return &instanceSlots{busy: map[int]bool{}, released: make(chan struct{}, 1)}
+}
+
+// active is how many instances are taken
+func (s *instanceSlots) active() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return len(s.busy)
+}
+
+// take takes the lowest free instance
+func (s *instanceSlots) take() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	instance := 0
+	for s.busy[instance] {
+		instance++
+	}
+
+	s.busy[instance] = true
+
+	return instance
+}
+
+func (s *instanceSlots) release(instance int) {
+	s.lock.Lock()
+	delete(s.busy, instance)
+	s.lock.Unlock()
+
+	select {
+	case s.released <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,150 @@
+package bifrost
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestControl(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "heimdall.sock")
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		},
+	}}
+
+	call := func(method, path string, out interface{}) int {
+		request, _ := http.NewRequest(method, "http://heimdall"+path, nil)
+
+		response, err := client.Do(request)
+		if err != nil {
+			return 0
+		}
+
+		defer response.Body.Close()
+
+		if out != nil {
+			json.NewDecoder(response.Body).Decode(out)
+		}
+
+		return response.StatusCode
+	}
+
+	// waitFor polls the running instances until check accepts them
+	waitFor := func(check func([]instanceStatus) bool) []instanceStatus {
+		var instances []instanceStatus
+		for i := 0; i < 100; i++ {
+			instances = nil
+			if call("GET", "/instances", &instances) == http.StatusOK && check(instances) {
+				break
+			}
+
+			time.Sleep(50 * time.Millisecond)
+		}
+
+		return instances
+	}
+
+	done := make(chan *summary)
+	go func() {
+		summary, err := execute(context.Background(), "", ManagerConfig{
+			AbsolutePath:     "/bin/sh",
+			ProgramArguments: []string{"-c", "echo started {{.Instance}}; exec sleep 10"},
+			Repeat:           1,
+			InParallelCount:  2,
+			ControlAddr:      unixPrefix + socket,
+		})
+		assert.Nil(t, err)
+
+		done <- summary
+	}()
+
+	instances := waitFor(func(instances []instanceStatus) bool { return len(instances) == 2 })
+	if !assert.Len(t, instances, 2) {
+		return
+	}
+
+	assert.Equal(t, 0, instances[0].Instance)
+	assert.True(t, instances[1].PID > 0)
+
+	var output []outputLine
+	waitFor(func([]instanceStatus) bool {
+		call("GET", "/instances/1/output", &output)
+		return len(output) > 0
+	})
+	if assert.Len(t, output, 1) {
+		assert.Equal(t, outputLine{Seq: output[0].Seq, RunID: instances[1].RunID, Stream: "stdout", Line: "started 1"}, output[0])
+	}
+
+	assert.Equal(t, http.StatusBadRequest, call("POST", "/scale?parallel=0", nil))
+	assert.Equal(t, http.StatusNotFound, call("POST", "/instances/7/kill", nil))
+	assert.Equal(t, http.StatusNotFound, call("GET", "/status?job=missing", nil))
+
+	// the restarted run is held back until resumed
+	var status []jobStatus
+	assert.Equal(t, http.StatusOK, call("POST", "/pause", &status))
+	assert.True(t, status[0].Paused)
+
+	assert.Equal(t, http.StatusOK, call("POST", "/instances/0/restart", nil))
+	instances = waitFor(func(instances []instanceStatus) bool { return len(instances) == 1 })
+	assert.Equal(t, 1, instances[0].Instance)
+
+	assert.Equal(t, http.StatusOK, call("POST", "/instances/1/kill", nil))
+	assert.Equal(t, http.StatusOK, call("POST", "/resume", nil))
+
+	instances = waitFor(func(instances []instanceStatus) bool { return len(instances) == 1 && instances[0].Instance == 0 })
+	assert.Equal(t, 3, instances[0].RunID)
+	assert.Equal(t, http.StatusOK, call("POST", "/instances/0/kill", nil))
+
+	select {
+	case summary := <-done:
+		assert.Equal(t, 3, summary.total.Runs)
+		assert.Equal(t, 3, summary.total.Killed)
+	case <-time.After(5 * time.Second):
+		t.Fatal("execution didn't finish once every instance was killed")
+	}
+
+	// the socket is removed once the execution is over
+	assert.Equal(t, 0, call("GET", "/status", nil))
+}
+
+func TestControlScale(t *testing.T) {
+	c := newControl("", ManagerConfig{InParallelCount: 2}, false)
+	assert.Nil(t, c.scale(4))
+	assert.Equal(t, 4, c.parallelism())
+
+	assert.Equal(t, errScaleRamped, newControl("", ManagerConfig{InParallelCount: 2}, true).scale(4))
+
+	c.record(runInfo{Instance: 0, RunID: 1}, "stdout", "line\n")
+	for i := 0; i < outputLines; i++ {
+		c.record(runInfo{Instance: 0, RunID: 2}, "stderr", "more\n")
+	}
+
+	assert.Len(t, c.recent(0, 0, 0), outputLines)
+	assert.Equal(t, []outputLine{{Seq: outputLines + 1, RunID: 2, Stream: "stderr", Line: "more"}}, c.recent(0, 1, 0))
+	assert.Len(t, c.recent(0, 0, outputLines-1), 2)
+}
+
+func TestControlLoopback(t *testing.T) {
+	// the control API can kill runs, so it isn't served beyond this machine
+	_, err := listenControl("0.0.0.0:0")
+	assert.NotNil(t, err)
+
+	err = ManagerConfig{AbsolutePath: "/bin/true", Repeat: 1, InParallelCount: 1, ControlAddr: "0.0.0.0:8080"}.Validate()
+	assert.Equal(t, "ControlAddr", err.(ConfigErrors)[0].Field)
+
+	// leaving the host out doesn't listen on every interface either
+	listener, err := listenControl(":0")
+	if assert.Nil(t, err) {
+		assert.True(t, listener.Addr().(*net.TCPAddr).IP.IsLoopback())
+		listener.Close()
+	}
+}
@@ -0,0 +1,256 @@
+// Copyright 2019 John Darrington johnw.darrington@gmail.com
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package bifrost
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// maxDiffCells bounds the size of the table used when diffing two outputs so that a pair of very large outputs
+// can't exhaust memory at the end of a run.
+const maxDiffCells = 4000000
+
+// diffContext is the number of unchanged lines shown around every change in a divergence diff
+const diffContext = 3
+
+// outputGroup holds every run which produced the same normalized stdout
+type outputGroup struct {
+	hash   string
+	output string
+	runs   []runInfo
+}
+
+// divergence records the normalized stdout of every run so that runs producing different output can be reported.
+// Runs are only compared against runs of the same matrix cell, and only the first output seen for each hash is kept
+// in memory.
+type divergence struct {
+	lock      sync.Mutex
+	cells     map[string]*cellOutputs
+	cellOrder []string
+}
+
+// cellOutputs groups the runs of a single matrix cell by their output
+type cellOutputs struct {
+	groups map[string]*outputGroup
+	order  []string
+}
+
+func newDivergence() *divergence {
+	return &divergence{cells: map[string]*cellOutputs{}}
+}
+
+func (d *divergence) record(run runInfo, stdout string) {
+	normalized := normalizeOutput(stdout)
+	sum := sha256.Sum256([]byte(normalized))
+	hash := hex.EncodeToString(sum[:])
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	cell, ok := d.cells[run.Cell]
+	if !ok {
+		cell = &cellOutputs{groups: map[string]*outputGroup{}}
+		d.cells[run.Cell] = cell
+		d.cellOrder = append(d.cellOrder, run.Cell)
+	}
+
+	group, ok := cell.groups[hash]
+	if !ok {
+		group = &outputGroup{hash: hash, output: normalized}
+		cell.groups[hash] = group
+		cell.order = append(cell.order, hash)
+	}
+
+	group.runs = append(group.runs, run)
+}
+
+// sorted returns the output groups of a cell, most common first. Groups with the same amount of runs keep the order
+// in which they were first seen.
+func (d *divergence) sorted(cell string) []*outputGroup {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	outputs, ok := d.cells[cell]
+	if !ok {
+		return nil
+	}
+
+	groups := make([]*outputGroup, 0, len(outputs.order))
+	for _, hash := range outputs.order {
+		groups = append(groups, outputs.groups[hash])
+	}
+
+	sort.SliceStable(groups, func(i, j int) bool {
+		return len(groups[i].runs) > len(groups[j].runs)
+	})
+
+	return groups
+}
+
+// report writes, for every matrix cell, the amount of distinct outputs, the runs belonging to each and a diff between
+// the most common output and every outlier.
+func (d *divergence) report(w io.Writer) {
+	d.lock.Lock()
+	cells := append([]string(nil), d.cellOrder...)
+	d.lock.Unlock()
+
+	for _, cell := range cells {
+		groups := d.sorted(cell)
+
+		total := 0
+		for _, group := range groups {
+			total += len(group.runs)
+		}
+
+		if cell != "" {
+			fmt.Fprintf(w, "heimdall: [%s] %d runs produced %d distinct output(s)\n", cell, total, len(groups))
+		} else {
+			fmt.Fprintf(w, "heimdall: %d runs produced %d distinct output(s)\n", total, len(groups))
+		}
+
+		for i, group := range groups {
+			label := ""
+			if i == 0 && len(groups) > 1 {
+				label = " (most common)"
+			}
+
+			fmt.Fprintf(w, "  [%s] %d run(s)%s\n", group.hash[:12], len(group.runs), label)
+
+			for _, run := range group.runs {
+				fmt.Fprintf(w, "      %s\n", run)
+			}
+		}
+
+		common := groups[0]
+		for _, outlier := range groups[1:] {
+			fmt.Fprintf(w, "--- [%s] most common\n+++ [%s] outlier\n", common.hash[:12], outlier.hash[:12])
+			fmt.Fprint(w, diffLines(common.output, outlier.output))
+		}
+	}
+}
+
+// normalizeOutput makes output comparable across platforms by normalizing line endings and ignoring trailing
+// whitespace and trailing blank lines.
+func normalizeOutput(output string) string {
+	lines := strings.Split(strings.Replace(output, "\r\n", "\n", -1), "\n")
+
+	for i := range lines {
+		lines[i] = strings.TrimRight(lines[i], " \t\r")
+	}
+
+	return strings.TrimRight(strings.Join(lines, "\n"), "\n")
+}
+
+// diffLines returns a unified style diff of two outputs built from their longest common subsequence of lines
+func diffLines(a, b string) string {
+	aLines := strings.Split(a, "\n")
+	bLines := strings.Split(b, "\n")
+
+	if len(aLines)*len(bLines) > maxDiffCells {
+		return fmt.Sprintf("outputs too large to diff (%d and %d lines)\n", len(aLines), len(bLines))
+	}
+
+	// lcs[i][j] holds the length of the longest common subsequence of aLines[i:] and bLines[j:]
+	lcs := make([][]int, len(aLines)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(bLines)+1)
+	}
+
+	for i := len(aLines) - 1; i >= 0; i-- {
+		for j := len(bLines) - 1; j >= 0; j-- {
+			if aLines[i] == bLines[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	type edit struct {
+		op   byte
+		line string
+		a, b int
+	}
+
+	var edits []edit
+	i, j := 0, 0
+	for i < len(aLines) || j < len(bLines) {
+		switch {
+		case i < len(aLines) && j < len(bLines) && aLines[i] == bLines[j]:
+			edits = append(edits, edit{' ', aLines[i], i, j})
+			i++
+			j++
+		case j == len(bLines) || (i < len(aLines) && lcs[i+1][j] >= lcs[i][j+1]):
+			edits = append(edits, edit{'-', aLines[i], i, j})
+			i++
+		default:
+			edits = append(edits, edit{'+', bLines[j], i, j})
+			j++
+		}
+	}
+
+	// group the edits into hunks, keeping diffContext unchanged lines around every change
+	var out strings.Builder
+	for start := 0; start < len(edits); {
+		if edits[start].op == ' ' {
+			start++
+			continue
+		}
+
+		first := start - diffContext
+		if first < 0 {
+			first = 0
+		}
+
+		last := start
+		for k := start; k < len(edits) && k <= last+2*diffContext; k++ {
+			if edits[k].op != ' ' {
+				last = k
+			}
+		}
+
+		end := last + diffContext + 1
+		if end > len(edits) {
+			end = len(edits)
+		}
+
+		aCount, bCount := 0, 0
+		for _, e := range edits[first:end] {
+			if e.op != '+' {
+				aCount++
+			}
+			if e.op != '-' {
+				bCount++
+			}
+		}
+
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", edits[first].a+1, aCount, edits[first].b+1, bCount)
+		for _, e := range edits[first:end] {
+			fmt.Fprintf(&out, "%c%s\n", e.op, e.line)
+		}
+
+		start = end
+	}
+
+	return out.String()
+}
@@ -0,0 +1,38 @@
+package bifrost
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDivergenceGroupsRunsByOutput(t *testing.T) {
+	d := newDivergence()
+
+	d.record(runInfo{Instance: 0, Repetition: 0}, "a\nb\nc\n")
+	d.record(runInfo{Instance: 1, Repetition: 0}, "a\r\nb  \r\nc\r\n\r\n")
+	d.record(runInfo{Instance: 0, Repetition: 1}, "a\nx\nc\n")
+
+	groups := d.sorted("")
+	assert.Len(t, groups, 2)
+	assert.Len(t, groups[0].runs, 2)
+	assert.Equal(t, []runInfo{{Instance: 0, Repetition: 1}}, groups[1].runs)
+
+	d.record(runInfo{Cell: "size=1"}, "a\nx\nc\n")
+	assert.Len(t, d.sorted("size=1"), 1)
+
+	out := &bytes.Buffer{}
+	d.report(out)
+
+	assert.True(t, strings.Contains(out.String(), "3 runs produced 2 distinct output(s)"))
+	assert.True(t, strings.Contains(out.String(), "-b\n+x\n"))
+}
+
+func TestDiffLines(t *testing.T) {
+	diff := diffLines("1\n2\n3\n4\n5\n6\n7\n8\n9\n10", "1\n2\n3\n4\n5\n6\n7\n8\n9\nten")
+
+	assert.Equal(t, "@@ -7,4 +7,4 @@\n 7\n 8\n 9\n-10\n+ten\n", diff)
+	assert.Equal(t, "", diffLines("same", "same"))
+}
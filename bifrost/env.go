@@ -0,0 +1,108 @@
+// Copyright 2019 John Darrington johnw.darrington@gmail.com
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package bifrost
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Environment variables set for every run of the managed program
+const (
+	EnvInstance   = "HEIMDALL_INSTANCE"
+	EnvRepetition = "HEIMDALL_REPETITION"
+	EnvRunID      = "HEIMDALL_RUN_ID"
+
+	// EnvParamPrefix is followed by the upper cased name of each matrix parameter, e.g HEIMDALL_PARAM_SIZE
+	EnvParamPrefix = "HEIMDALL_PARAM_"
+)
+
+// ValidateEnv makes sure every environment entry is in KEY=VALUE form, as Env expects
+func ValidateEnv(env []string) error {
+	for _, entry := range env {
+		if strings.Index(entry, "=") < 1 {
+			return fmt.Errorf("invalid environment variable %q, expected KEY=VALUE", entry)
+		}
+	}
+
+	return nil
+}
+
+// environment builds the environment for a single run. Heimdall's own environment is the base unless CleanEnv is set,
+// UnsetEnv and Env are then applied in that order before the per run variables are added.
+func environment(config ManagerConfig, run runInfo) []string {
+	var base []string
+	if !config.CleanEnv {
+		base = os.Environ()
+	}
+
+	removed := map[string]bool{}
+	for _, key := range config.UnsetEnv {
+		removed[key] = true
+	}
+
+	for _, entry := range config.Env {
+		removed[envKey(entry)] = true
+	}
+
+	for _, key := range []string{EnvInstance, EnvRepetition, EnvRunID} {
+		removed[key] = true
+	}
+
+	env := make([]string, 0, len(base)+len(config.Env)+3)
+	for _, entry := range base {
+		if !removed[envKey(entry)] {
+			env = append(env, entry)
+		}
+	}
+
+	env = append(env, config.Env...)
+	env = append(env,
+		EnvInstance+"="+strconv.Itoa(run.Instance),
+		EnvRepetition+"="+strconv.Itoa(run.Repetition),
+		EnvRunID+"="+strconv.Itoa(run.RunID))
+
+	names := make([]string, 0, len(run.Params))
+	for name := range run.Params {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	for _, name := range names {
+		env = append(env, paramEnvKey(name)+"="+run.Params[name])
+	}
+
+	return env
+}
+
+// paramEnvKey upper cases a matrix parameter name and replaces anything but letters and digits with underscores
+func paramEnvKey(name string) string {
+	key := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+
+		return '_'
+	}, name)
+
+	return EnvParamPrefix + strings.ToUpper(key)
+}
+
+func envKey(entry string) string {
+	return strings.SplitN(entry, "=", 2)[0]
+}
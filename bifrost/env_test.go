@@ -0,0 +1,29 @@
+package bifrost
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnvironment(t *testing.T) {
+	t.Setenv("HEIMDALL_TEST_KEEP", "keep")
+	t.Setenv("HEIMDALL_TEST_UNSET", "unset")
+	t.Setenv("HEIMDALL_TEST_OVERRIDE", "old")
+
+	env := environment(ManagerConfig{
+		Env:      []string{"HEIMDALL_TEST_OVERRIDE=new"},
+		UnsetEnv: []string{"HEIMDALL_TEST_UNSET"},
+	}, runInfo{Instance: 1, Repetition: 2, RunID: 3})
+
+	assert.Contains(t, env, "HEIMDALL_TEST_KEEP=keep")
+	assert.Contains(t, env, "HEIMDALL_TEST_OVERRIDE=new")
+	assert.NotContains(t, env, "HEIMDALL_TEST_OVERRIDE=old")
+	assert.NotContains(t, env, "HEIMDALL_TEST_UNSET=unset")
+	assert.Contains(t, env, "HEIMDALL_INSTANCE=1")
+	assert.Contains(t, env, "HEIMDALL_REPETITION=2")
+	assert.Contains(t, env, "HEIMDALL_RUN_ID=3")
+
+	clean := environment(ManagerConfig{CleanEnv: true, Env: []string{"A=b"}}, runInfo{})
+	assert.Equal(t, []string{"A=b", "HEIMDALL_INSTANCE=0", "HEIMDALL_REPETITION=0", "HEIMDALL_RUN_ID=0"}, clean)
+}
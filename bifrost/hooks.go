@@ -0,0 +1,190 @@
+// Copyright 2019 John Darrington johnw.darrington@gmail.com
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package bifrost
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// Environment variables set for hooks in addition to those every run of the managed program receives
+const (
+	// EnvExitCode, EnvDuration, EnvTimedOut and EnvLogPath describe the run an AfterEach hook follows. The duration
+	// is in seconds and the log path absolute.
+	EnvExitCode = "HEIMDALL_EXIT_CODE"
+	EnvDuration = "HEIMDALL_DURATION"
+	EnvTimedOut = "HEIMDALL_TIMED_OUT"
+	EnvLogPath  = "HEIMDALL_LOG_PATH"
+
+	// EnvRuns and EnvFailed count the runs of the execution an AfterAll hook follows
+	EnvRuns   = "HEIMDALL_RUNS"
+	EnvFailed = "HEIMDALL_FAILED"
+)
+
+// HookConfig holds shell commands run around the managed program. They are run through the configured Shell in
+// the program's working directory and environment. BeforeEach and AfterEach are rendered as templates like
+// ProgramArguments.
+//
+// A failing BeforeAll stops the execution before any run and a failing BeforeEach fails the run it precedes
+// without starting the program. Failing AfterEach and AfterAll hooks are reported but don't change the outcome
+// of any run.
+type HookConfig struct {
+	BeforeAll  string
+	BeforeEach string
+	AfterEach  string
+	AfterAll   string
+}
+
+// hooks runs the hooks of a single execution
+type hooks struct {
+	config ManagerConfig
+
+	beforeEach *template.Template
+	afterEach  *template.Template
+}
+
+func newHooks(config ManagerConfig) (*hooks, error) {
+	h := &hooks{config: config}
+
+	var err error
+	if config.Hooks.BeforeEach != "" {
+		if h.beforeEach, err = parseTemplate("beforeEach", config.Hooks.BeforeEach); err != nil {
+			return nil, err
+		}
+	}
+
+	if config.Hooks.AfterEach != "" {
+		if h.afterEach, err = parseTemplate("afterEach", config.Hooks.AfterEach); err != nil {
+			return nil, err
+		}
+	}
+
+	return h, nil
+}
+
+func (h *hooks) runBeforeAll() error {
+	if h.config.Hooks.BeforeAll == "" {
+		return nil
+	}
+
+	return h.run("before all", h.config.Hooks.BeforeAll, h.baseEnvironment())
+}
+
+func (h *hooks) runAfterAll(s *summary) error {
+	if h.config.Hooks.AfterAll == "" {
+		return nil
+	}
+
+	s.lock.Lock()
+	env := append(h.baseEnvironment(),
+		EnvRuns+"="+strconv.Itoa(s.total.Runs),
+		EnvFailed+"="+strconv.Itoa(s.total.Failed))
+	s.lock.Unlock()
+
+	return h.run("after all", h.config.Hooks.AfterAll, env)
+}
+
+func (h *hooks) runBeforeEach(run runInfo) error {
+	if h.beforeEach == nil {
+		return nil
+	}
+
+	command, err := renderHook(h.beforeEach, run)
+	if err != nil {
+		return err
+	}
+
+	return h.run("before each", command, environment(h.config, run))
+}
+
+func (h *hooks) runAfterEach(result runResult) error {
+	if h.afterEach == nil {
+		return nil
+	}
+
+	command, err := renderHook(h.afterEach, result.runInfo)
+	if err != nil {
+		return err
+	}
+
+	// the hook runs in the program's working directory, the log's path is relative to heimdall's
+	logPath := ""
+	if h.config.Log {
+		logPath, _ = filepath.Abs(h.config.LogName)
+	}
+
+	env := append(environment(h.config, result.runInfo),
+		EnvExitCode+"="+strconv.Itoa(result.ExitCode),
+		EnvDuration+"="+strconv.FormatFloat(result.duration.Seconds(), 'f', 3, 64),
+		EnvTimedOut+"="+strconv.FormatBool(result.TimedOut),
+		EnvLogPath+"="+logPath)
+
+	return h.run("after each", command, env)
+}
+
+// baseEnvironment is the environment of hooks which don't belong to a single run
+func (h *hooks) baseEnvironment() []string {
+	env := environment(h.config, runInfo{})
+
+	// the per run variables would only be misleading here
+	filtered := env[:0]
+	for _, entry := range env {
+		switch envKey(entry) {
+		case EnvInstance, EnvRepetition, EnvRunID:
+			continue
+		}
+
+		filtered = append(filtered, entry)
+	}
+
+	return filtered
+}
+
+// run executes a hook through the shell, its output goes straight to heimdall's own
+func (h *hooks) run(name, command string, env []string) error {
+	return h.runContext(context.Background(), name, command, env)
+}
+
+// runContext runs a hook like run, killing it if ctx is done before it exits
+func (h *hooks) runContext(ctx context.Context, name, command string, env []string) error {
+	shell := shellInvocation(h.config)
+
+	hook := exec.CommandContext(ctx, shell[0], append(shell[1:], command)...)
+	hook.Env = env
+	hook.Dir = h.config.WorkingDir
+	hook.Stdout = os.Stdout
+	hook.Stderr = os.Stderr
+
+	if err := hook.Run(); err != nil {
+		return fmt.Errorf("%s hook failed: %s", name, err)
+	}
+
+	return nil
+}
+
+func renderHook(t *template.Template, run runInfo) (string, error) {
+	out := &strings.Builder{}
+	if err := t.Execute(out, run); err != nil {
+		return "", err
+	}
+
+	return out.String(), nil
+}
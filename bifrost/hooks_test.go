@@ -0,0 +1,61 @@
+package bifrost
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHooks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "heimdall")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	summary, err := execute(context.Background(), "", ManagerConfig{
+		AbsolutePath:    "/bin/false",
+		Repeat:          2,
+		InParallelCount: 1,
+		WorkingDir:      dir,
+		Hooks: HookConfig{
+			BeforeAll:  "echo before-all >> hooks.txt",
+			BeforeEach: "test {{.Repetition}} -eq 0",
+			AfterEach:  "echo after-{{.RunID}}-$HEIMDALL_EXIT_CODE >> hooks.txt",
+			AfterAll:   "echo after-all-$HEIMDALL_RUNS-$HEIMDALL_FAILED >> hooks.txt",
+		},
+	})
+	assert.Nil(t, err)
+	assert.True(t, summary.failed())
+
+	out, err := ioutil.ReadFile(filepath.Join(dir, "hooks.txt"))
+	assert.Nil(t, err)
+	assert.Equal(t, "before-all\nafter-1-1\nafter-all-2-2\n", string(out))
+
+	_, err = execute(context.Background(), "", ManagerConfig{AbsolutePath: "/bin/true", Repeat: 1, InParallelCount: 1, Hooks: HookConfig{BeforeAll: "exit 1"}})
+	assert.NotNil(t, err)
+}
+
+func TestHooksLogPath(t *testing.T) {
+	dir := t.TempDir()
+	wd, _ := os.Getwd()
+
+	// the log is relative to heimdall's working directory while the hook runs in the program's
+	_, err := execute(context.Background(), "", ManagerConfig{
+		AbsolutePath:    "/bin/true",
+		Repeat:          1,
+		InParallelCount: 1,
+		WorkingDir:      dir,
+		Log:             true,
+		LogName:         "hooks_test.log",
+		Hooks:           HookConfig{AfterEach: "echo $HEIMDALL_LOG_PATH > log-path.txt"},
+	})
+	assert.Nil(t, err)
+	defer os.Remove("hooks_test.log")
+
+	out, err := ioutil.ReadFile(filepath.Join(dir, "log-path.txt"))
+	assert.Nil(t, err)
+	assert.Equal(t, filepath.Join(wd, "hooks_test.log")+"\n", string(out))
+}
@@ -0,0 +1,83 @@
+// Copyright 2019 John Darrington johnw.darrington@gmail.com
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package bifrost
+
+import (
+	"os"
+	"regexp"
+)
+
+// interpolation matches ${VAR} references, along with their $${VAR} escaped form
+var interpolation = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// Interpolate replaces every ${VAR} in value with the value of the environment variable VAR. References to unset
+// variables are left as they are, so that hooks may still refer to the variables heimdall sets while running, and
+// $${VAR} is always written out as a literal ${VAR}.
+func Interpolate(value string) string {
+	return interpolation.ReplaceAllStringFunc(value, func(reference string) string {
+		if reference[1] == '$' {
+			return reference[1:]
+		}
+
+		if env, ok := os.LookupEnv(interpolation.FindStringSubmatch(reference)[1]); ok {
+			return env
+		}
+
+		return reference
+	})
+}
+
+// InterpolateSettings returns a copy of a configuration file's settings with every string value interpolated, see
+// Interpolate
+func InterpolateSettings(settings map[string]interface{}) map[string]interface{} {
+	return interpolateValue(settings).(map[string]interface{})
+}
+
+func interpolateValue(value interface{}) interface{} {
+	switch value := value.(type) {
+	case string:
+		return Interpolate(value)
+	case []string:
+		interpolated := make([]string, len(value))
+		for i, item := range value {
+			interpolated[i] = Interpolate(item)
+		}
+
+		return interpolated
+	case []interface{}:
+		interpolated := make([]interface{}, len(value))
+		for i, item := range value {
+			interpolated[i] = interpolateValue(item)
+		}
+
+		return interpolated
+	case []map[string]interface{}:
+		interpolated := make([]map[string]interface{}, len(value))
+		for i, item := range value {
+			interpolated[i] = InterpolateSettings(item)
+		}
+
+		return interpolated
+	case map[string]interface{}:
+		interpolated := make(map[string]interface{}, len(value))
+		for k, item := range value {
+			interpolated[k] = interpolateValue(item)
+		}
+
+		return interpolated
+	default:
+		return value
+	}
+}
@@ -0,0 +1,40 @@
+package bifrost
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInterpolate(t *testing.T) {
+	t.Setenv("HEIMDALL_TEST_DIR", "/tmp/out")
+
+	// setting it first has the variable restored once the test is over
+	t.Setenv("HEIMDALL_TEST_MISSING", "")
+	os.Unsetenv("HEIMDALL_TEST_MISSING")
+
+	assert.Equal(t, "/tmp/out/heimdall.log", Interpolate("${HEIMDALL_TEST_DIR}/heimdall.log"))
+	assert.Equal(t, "${HEIMDALL_TEST_MISSING}", Interpolate("${HEIMDALL_TEST_MISSING}"))
+	assert.Equal(t, "${HEIMDALL_TEST_DIR}", Interpolate("$${HEIMDALL_TEST_DIR}"))
+	assert.Equal(t, "error$", Interpolate("error$"))
+	assert.Equal(t, "$HEIMDALL_TEST_DIR", Interpolate("$HEIMDALL_TEST_DIR"))
+}
+
+func TestInterpolateSettings(t *testing.T) {
+	t.Setenv("HEIMDALL_TEST_DIR", "/tmp/out")
+
+	settings := InterpolateSettings(map[string]interface{}{
+		"logname":          "${HEIMDALL_TEST_DIR}/run.log",
+		"programarguments": []interface{}{"--out", "${HEIMDALL_TEST_DIR}"},
+		"repeat":           3,
+		"hooks":            map[string]interface{}{"afterall": "cp ${HEIMDALL_TEST_DIR}/run.log ."},
+	})
+
+	assert.Equal(t, map[string]interface{}{
+		"logname":          "/tmp/out/run.log",
+		"programarguments": []interface{}{"--out", "/tmp/out"},
+		"repeat":           3,
+		"hooks":            map[string]interface{}{"afterall": "cp /tmp/out/run.log ."},
+	}, settings)
+}
@@ -0,0 +1,181 @@
+// Copyright 2019 John Darrington johnw.darrington@gmail.com
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package bifrost
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DefaultJob names the only job of a configuration file describing a single program
+const DefaultJob = "default"
+
+// Job is a named program configuration loaded from a configuration file
+type Job struct {
+	Name   string
+	Config ManagerConfig
+}
+
+// JobSettings holds the settings of a single named job, keyed by lower cased ManagerConfig field names
+type JobSettings struct {
+	Name     string
+	Settings map[string]interface{}
+}
+
+// SplitJobs returns the settings of every job described by a configuration file's settings, whose keys must be lower
+// case, with Defaults merged in. A file may describe a single program, as written by "heimdall init", or several
+// named jobs -
+//
+//	{
+//	  "Defaults": {"TimeoutString": "5m", "Log": true},
+//	  "Jobs": {
+//	    "soak": {"AbsolutePath": "/bin/tool", "Repeat": 1000},
+//	    "smoke": {"AbsolutePath": "/bin/tool", "ProgramArguments": ["--quick"]}
+//	  }
+//	}
+//
+// Every job is a full ManagerConfig inheriting any field it leaves out from Defaults. Jobs are returned sorted by
+// name, a single program file is returned as one job named DefaultJob.
+func SplitJobs(settings map[string]interface{}) ([]JobSettings, error) {
+	rawJobs, ok := settings["jobs"]
+	if !ok {
+		return []JobSettings{{Name: DefaultJob, Settings: settings}}, nil
+	}
+
+	jobs, ok := rawJobs.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("jobs must be an object of job names to configurations")
+	}
+
+	defaults, err := DefaultSettings(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(jobs))
+	for name := range jobs {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	split := make([]JobSettings, 0, len(names))
+	for _, name := range names {
+		job, ok := jobs[name].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("job %q must be an object", name)
+		}
+
+		split = append(split, JobSettings{Name: name, Settings: mergeSettings(mergeSettings(map[string]interface{}{}, defaults), job)})
+	}
+
+	return split, nil
+}
+
+// DefaultSettings returns the settings shared by every job of a configuration file, or the settings of the only
+// program a configuration file without jobs describes
+func DefaultSettings(settings map[string]interface{}) (map[string]interface{}, error) {
+	if _, ok := settings["jobs"]; !ok {
+		return settings, nil
+	}
+
+	rawDefaults, ok := settings["defaults"]
+	if !ok {
+		return map[string]interface{}{}, nil
+	}
+
+	defaults, ok := rawDefaults.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("defaults must be an object")
+	}
+
+	return defaults, nil
+}
+
+// SelectJobs returns the named jobs in the order given, or every job when all is set. Any job a selected job depends
+// on, directly or not, is selected as well.
+func SelectJobs(jobs []Job, names []string, all bool) ([]Job, error) {
+	if all {
+		return jobs, nil
+	}
+
+	if len(names) == 0 {
+		if len(jobs) == 1 {
+			return jobs, nil
+		}
+
+		return nil, fmt.Errorf("choose the jobs to run or run them all, available jobs: %s", jobNames(jobs))
+	}
+
+	var selected []Job
+	chosen := map[string]bool{}
+
+	for len(names) > 0 {
+		name := names[0]
+		names = names[1:]
+
+		job, ok := findJob(jobs, name)
+		if !ok {
+			return nil, fmt.Errorf("unknown job %q, available jobs: %s", name, jobNames(jobs))
+		}
+
+		if chosen[job.Name] {
+			continue
+		}
+
+		chosen[job.Name] = true
+		selected = append(selected, job)
+		names = append(names, job.Config.DependsOn...)
+	}
+
+	return selected, nil
+}
+
+func findJob(jobs []Job, name string) (Job, bool) {
+	for _, job := range jobs {
+		if strings.EqualFold(job.Name, name) {
+			return job, true
+		}
+	}
+
+	return Job{}, false
+}
+
+func jobNames(jobs []Job) string {
+	names := make([]string, len(jobs))
+	for i, job := range jobs {
+		names[i] = job.Name
+	}
+
+	return strings.Join(names, ", ")
+}
+
+// mergeSettings copies src over dst, merging nested objects rather than replacing them, and returns dst
+func mergeSettings(dst, src map[string]interface{}) map[string]interface{} {
+	for key, value := range src {
+		nested, ok := value.(map[string]interface{})
+		existing, isMap := dst[key].(map[string]interface{})
+
+		if ok && isMap {
+			dst[key] = mergeSettings(mergeSettings(map[string]interface{}{}, existing), nested)
+			continue
+		}
+
+		dst[key] = value
+	}
+
+	return dst
+}
@@ -0,0 +1,32 @@
+package bifrost
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelectJobs(t *testing.T) {
+	jobs := []Job{
+		{Name: "build"},
+		{Name: "smoke", Config: ManagerConfig{DependsOn: []string{"build"}}},
+		{Name: "soak"},
+	}
+
+	selected, err := SelectJobs(jobs, []string{"Smoke"}, false)
+	assert.Nil(t, err)
+	if assert.Len(t, selected, 2) {
+		assert.Equal(t, "smoke", selected[0].Name)
+		assert.Equal(t, "build", selected[1].Name)
+	}
+
+	selected, err = SelectJobs(jobs, nil, true)
+	assert.Nil(t, err)
+	assert.Len(t, selected, 3)
+
+	_, err = SelectJobs(jobs, nil, false)
+	assert.NotNil(t, err)
+
+	_, err = SelectJobs(jobs, []string{"missing"}, false)
+	assert.NotNil(t, err)
+}
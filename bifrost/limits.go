@@ -0,0 +1,121 @@
+// Copyright 2019 John Darrington johnw.darrington@gmail.com
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package bifrost
+
+import (
+	"errors"
+	"time"
+)
+
+// LimitConfig constrains the resources of every run's process, enforced by the operating system rather than checked
+// once the run is over like ThresholdConfig. Limits are only supported on Linux.
+//
+// Memory caps the process's address space, in bytes or with a K, M or G suffix - e.g "512M". CPUTime caps its CPU
+// time, user and system together, as a Go duration. OpenFiles caps the file descriptors it may hold open and
+// Processes the processes its user may run at once - every process of the user counts, not only the run's. A run
+// killed for going over CPUTime is reported with that reason, going over any other limit makes the program's own
+// allocations, opens or forks fail.
+//
+// With Cgroup set every run is placed in a cgroup v2 of its own where available, Memory then capping memory.max and
+// Processes pids.max for the run alone, and CPUs capping cpu.max - e.g 0.5 for half a CPU. Runs killed by the out
+// of memory killer or held back by pids.max are reported with that reason. Runs' cgroups are created below
+// CgroupParent, a path below the cgroup v2 mount defaulting to heimdall's own cgroup, which must be delegated to the
+// user running heimdall. Heimdall falls back to rlimits when cgroups are unavailable.
+type LimitConfig struct {
+	Memory    string
+	CPUTime   string
+	OpenFiles int
+	Processes int
+
+	Cgroup       bool
+	CgroupParent string
+	CPUs         float64
+}
+
+// LimitedExecCommand is the first argument heimdall is started with to start a run's program with rlimits set, Go
+// having no way to set them on a process it starts. Heimdall's own command of that name calls ExecLimited, a program
+// embedding bifrost which limits runs must do the same.
+const LimitedExecCommand = "__exec"
+
+// limits holds a configuration's parsed LimitConfig, a zero field isn't limited
+type limits struct {
+	memory    int64
+	cpuTime   time.Duration
+	openFiles int
+	processes int
+	cpus      float64
+
+	cgroup       bool
+	cgroupParent string
+
+	// cgroupDir is the cgroup runs are placed below, empty when cgroups aren't used. It is only set once enable
+	// made sure the cgroup can hold the runs' own.
+	cgroupDir string
+}
+
+func newLimits(config ManagerConfig) (*limits, error) {
+	limit := config.Limits
+	l := &limits{openFiles: limit.OpenFiles, processes: limit.Processes, cpus: limit.CPUs,
+		cgroup: limit.Cgroup, cgroupParent: limit.CgroupParent}
+
+	if limit.Memory != "" {
+		memory, err := parseSize(limit.Memory)
+		if err != nil {
+			return nil, &FieldError{Field: "Limits.Memory", Err: err}
+		}
+
+		l.memory = memory
+	}
+
+	if limit.CPUTime != "" {
+		cpuTime, err := time.ParseDuration(limit.CPUTime)
+		if err != nil {
+			return nil, &FieldError{Field: "Limits.CPUTime", Err: err}
+		}
+
+		if cpuTime < 0 {
+			return nil, &FieldError{Field: "Limits.CPUTime", Err: errors.New("must not be negative")}
+		}
+
+		l.cpuTime = cpuTime
+	}
+
+	if limit.OpenFiles < 0 {
+		return nil, &FieldError{Field: "Limits.OpenFiles", Err: errors.New("must not be negative")}
+	}
+
+	if limit.Processes < 0 {
+		return nil, &FieldError{Field: "Limits.Processes", Err: errors.New("must not be negative")}
+	}
+
+	if limit.CPUs < 0 {
+		return nil, &FieldError{Field: "Limits.CPUs", Err: errors.New("must not be negative")}
+	}
+
+	if limit.CPUs > 0 && !limit.Cgroup {
+		return nil, &FieldError{Field: "Limits.CPUs", Err: errors.New("requires Cgroup")}
+	}
+
+	if l.set() && !limitsSupported {
+		return nil, &FieldError{Field: "Limits", Err: errors.New("resource limits are only supported on Linux")}
+	}
+
+	return l, nil
+}
+
+// set reports whether any limit is set
+func (l *limits) set() bool {
+	return l.memory > 0 || l.cpuTime > 0 || l.openFiles > 0 || l.processes > 0 || l.cpus > 0
+}
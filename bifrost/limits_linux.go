@@ -0,0 +1,415 @@
+// Copyright 2019 John Darrington johnw.darrington@gmail.com
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+//go:build linux
+
+package bifrost
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// limitsSupported reports whether the platform can limit the resources of a run's process
+const limitsSupported = true
+
+// cpuPeriod is the cpu.max period, in microseconds, CPUs is turned into a quota of
+const cpuPeriod = 100000
+
+// enable prepares the cgroup runs are placed below when cgroups are asked for, falling back to rlimits with a
+// warning when cgroups are unavailable
+func (l *limits) enable() {
+	if !l.cgroup || !l.set() {
+		return
+	}
+
+	dir, err := l.cgroupParentDir()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "heimdall: cgroup limits unavailable, falling back to rlimits: %s\n", err)
+
+		if l.cpus > 0 {
+			fmt.Fprintln(os.Stderr, "heimdall: CPUs can't be limited without cgroups")
+		}
+
+		return
+	}
+
+	l.cgroupDir = dir
+}
+
+// cgroupParentDir finds the cgroup runs are placed below and enables the controllers their limits need in it
+func (l *limits) cgroupParentDir() (string, error) {
+	mount, err := cgroupMount()
+	if err != nil {
+		return "", err
+	}
+
+	parent := l.cgroupParent
+	if parent == "" {
+		if parent, err = ownCgroup(); err != nil {
+			return "", err
+		}
+	}
+
+	dir := filepath.Join(mount, parent)
+
+	var needed []string
+	if l.memory > 0 {
+		needed = append(needed, "memory")
+	}
+
+	if l.cpus > 0 {
+		needed = append(needed, "cpu")
+	}
+
+	if l.processes > 0 {
+		needed = append(needed, "pids")
+	}
+
+	available, err := ioutil.ReadFile(filepath.Join(dir, "cgroup.controllers"))
+	if err != nil {
+		return "", err
+	}
+
+	enabled, err := ioutil.ReadFile(filepath.Join(dir, "cgroup.subtree_control"))
+	if err != nil {
+		return "", err
+	}
+
+	for _, controller := range needed {
+		if !containsField(string(available), controller) {
+			return "", fmt.Errorf("the %s controller isn't available in %s", controller, dir)
+		}
+
+		if containsField(string(enabled), controller) {
+			continue
+		}
+
+		// a cgroup holding processes of its own, as heimdall's usually does, can't enable controllers for its children
+		if err := ioutil.WriteFile(filepath.Join(dir, "cgroup.subtree_control"), []byte("+"+controller), 0644); err != nil {
+			return "", fmt.Errorf("enabling the %s controller in %s: %s", controller, dir, err)
+		}
+	}
+
+	return dir, nil
+}
+
+func containsField(s, field string) bool {
+	for _, f := range strings.Fields(s) {
+		if f == field {
+			return true
+		}
+	}
+
+	return false
+}
+
+// cgroupMount returns where the cgroup v2 hierarchy is mounted
+func cgroupMount() (string, error) {
+	mountInfo, err := ioutil.ReadFile("/proc/self/mountinfo")
+	if err != nil {
+		return "", err
+	}
+
+	for _, line := range strings.Split(string(mountInfo), "\n") {
+		// optional fields are separated from the filesystem type by a lone hyphen
+		parts := strings.SplitN(line, " - ", 2)
+		if len(parts) != 2 || !strings.HasPrefix(parts[1], "cgroup2 ") {
+			continue
+		}
+
+		if fields := strings.Fields(parts[0]); len(fields) > 4 {
+			return fields[4], nil
+		}
+	}
+
+	return "", errors.New("no cgroup v2 hierarchy is mounted")
+}
+
+// ownCgroup returns heimdall's own cgroup v2, relative to the mount
+func ownCgroup() (string, error) {
+	cgroups, err := ioutil.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return "", err
+	}
+
+	for _, line := range strings.Split(string(cgroups), "\n") {
+		if strings.HasPrefix(line, "0::") {
+			return strings.TrimPrefix(line, "0::"), nil
+		}
+	}
+
+	return "", errors.New("heimdall isn't part of a cgroup v2")
+}
+
+// runLimits applies a configuration's limits to a single run
+type runLimits struct {
+	limits *limits
+
+	// cgroup is the run's own cgroup, open while the run lasts so the program can be started inside it
+	cgroup    string
+	cgroupDir *os.File
+}
+
+// prepare readies the limits of a run about to be started, placing the command in its own cgroup if cgroups are
+// used and having it started with its rlimits set. Nil is returned when nothing is limited.
+func (l *limits) prepare(cmd *exec.Cmd, run runInfo) (*runLimits, error) {
+	if l == nil || !l.set() {
+		return nil, nil
+	}
+
+	r := &runLimits{limits: l}
+	if l.cgroupDir == "" {
+		if rlimits := r.rlimits(); len(rlimits) > 0 {
+			if err := r.wrap(cmd, rlimits); err != nil {
+				return nil, err
+			}
+		}
+
+		return r, nil
+	}
+
+	r.cgroup = filepath.Join(l.cgroupDir, fmt.Sprintf("heimdall-%d-run-%d", os.Getpid(), run.RunID))
+	if err := os.Mkdir(r.cgroup, 0755); err != nil {
+		return nil, err
+	}
+
+	settings := map[string]string{}
+	if l.memory > 0 {
+		settings["memory.max"] = strconv.FormatInt(l.memory, 10)
+		// swapping would only delay the out of memory killer
+		settings["memory.swap.max"] = "0"
+	}
+
+	if l.cpus > 0 {
+		settings["cpu.max"] = fmt.Sprintf("%d %d", int64(l.cpus*cpuPeriod), cpuPeriod)
+	}
+
+	if l.processes > 0 {
+		settings["pids.max"] = strconv.Itoa(l.processes)
+	}
+
+	for file, value := range settings {
+		err := ioutil.WriteFile(filepath.Join(r.cgroup, file), []byte(value), 0644)
+
+		// not every kernel accounts for swap
+		if err != nil && !(file == "memory.swap.max" && os.IsNotExist(err)) {
+			r.close()
+			return nil, fmt.Errorf("setting %s: %s", file, err)
+		}
+	}
+
+	dir, err := os.Open(r.cgroup)
+	if err != nil {
+		r.close()
+		return nil, err
+	}
+
+	r.cgroupDir = dir
+
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = int(dir.Fd())
+
+	if rlimits := r.rlimits(); len(rlimits) > 0 {
+		if err := r.wrap(cmd, rlimits); err != nil {
+			r.close()
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+// rlimits returns the rlimits a run's process is started with, the run's cgroup limiting memory and processes
+// instead when there is one
+func (r *runLimits) rlimits() map[int]unix.Rlimit {
+	l := r.limits
+	rlimits := map[int]unix.Rlimit{}
+
+	if l.cpuTime > 0 {
+		// the process is sent SIGXCPU at the soft limit and killed a second later at the hard limit
+		seconds := uint64(math.Ceil(l.cpuTime.Seconds()))
+		rlimits[unix.RLIMIT_CPU] = unix.Rlimit{Cur: seconds, Max: seconds + 1}
+	}
+
+	if l.openFiles > 0 {
+		rlimits[unix.RLIMIT_NOFILE] = unix.Rlimit{Cur: uint64(l.openFiles), Max: uint64(l.openFiles)}
+	}
+
+	if r.cgroup != "" {
+		return rlimits
+	}
+
+	if l.memory > 0 {
+		rlimits[unix.RLIMIT_AS] = unix.Rlimit{Cur: uint64(l.memory), Max: uint64(l.memory)}
+	}
+
+	if l.processes > 0 {
+		rlimits[unix.RLIMIT_NPROC] = unix.Rlimit{Cur: uint64(l.processes), Max: uint64(l.processes)}
+	}
+
+	return rlimits
+}
+
+// wrap has heimdall start a run's program itself, setting the rlimits before replacing itself with the program so
+// they are in force from its first instruction. Go can't set rlimits of a process it starts any other way.
+func (r *runLimits) wrap(cmd *exec.Cmd, rlimits map[int]unix.Rlimit) error {
+	heimdall, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("finding heimdall to set the rlimits: %s", err)
+	}
+
+	var encoded []string
+	for resource, rlimit := range rlimits {
+		encoded = append(encoded, fmt.Sprintf("%d=%d:%d", resource, rlimit.Cur, rlimit.Max))
+	}
+
+	cmd.Args = append([]string{heimdall, LimitedExecCommand, strings.Join(encoded, ","), cmd.Path}, cmd.Args...)
+	cmd.Path = heimdall
+
+	return nil
+}
+
+// ExecLimited sets the rlimits a run's program is limited by and replaces the calling process with the program, see
+// LimitedExecCommand. Args are the command's arguments - the rlimits, the program's path and its arguments, its name
+// included. ExecLimited only returns when either can't be done.
+func ExecLimited(args []string) error {
+	if len(args) < 3 {
+		return errors.New("no program to start")
+	}
+
+	rlimits := map[int]unix.Rlimit{}
+	for _, entry := range strings.Split(args[0], ",") {
+		var resource int
+		var rlimit unix.Rlimit
+		if _, err := fmt.Sscanf(entry, "%d=%d:%d", &resource, &rlimit.Cur, &rlimit.Max); err != nil {
+			return fmt.Errorf("invalid rlimit %q: %s", entry, err)
+		}
+
+		rlimits[resource] = rlimit
+	}
+
+	// heimdall itself must not need more memory or threads once they're limited
+	for resource, rlimit := range rlimits {
+		rlimit := rlimit
+		if err := unix.Setrlimit(resource, &rlimit); err != nil {
+			return fmt.Errorf("setting rlimit %d: %s", resource, err)
+		}
+	}
+
+	return unix.Exec(args[1], args[2:], os.Environ())
+}
+
+// finished returns the limit a run went over, empty if it went over none that can be told
+func (r *runLimits) finished(state *os.ProcessState) string {
+	if r == nil {
+		return ""
+	}
+
+	l := r.limits
+
+	if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() && l.cpuTime > 0 {
+		cpu := state.UserTime() + state.SystemTime()
+		if status.Signal() == syscall.SIGXCPU || (status.Signal() == syscall.SIGKILL && cpu >= l.cpuTime) {
+			return fmt.Sprintf("killed for going over the cpu time limit of %s", l.cpuTime)
+		}
+	}
+
+	if r.cgroup == "" {
+		return ""
+	}
+
+	if l.memory > 0 && cgroupEvent(r.cgroup, "memory.events", "oom_kill") > 0 {
+		return fmt.Sprintf("killed by the out of memory killer for going over the memory limit of %s", formatSize(l.memory))
+	}
+
+	if l.processes > 0 && cgroupEvent(r.cgroup, "pids.events", "max") > 0 {
+		return fmt.Sprintf("held back by the process limit of %d", l.processes)
+	}
+
+	return ""
+}
+
+// cgroupPath returns the run's own cgroup, empty without one
+func (r *runLimits) cgroupPath() string {
+	if r == nil {
+		return ""
+	}
+
+	return r.cgroup
+}
+
+// peakMemory returns the peak memory of every process of the run from its cgroup, zero without one or on kernels
+// which don't report it
+func (r *runLimits) peakMemory() int64 {
+	if r == nil || r.cgroup == "" {
+		return 0
+	}
+
+	peak, err := ioutil.ReadFile(filepath.Join(r.cgroup, "memory.peak"))
+	if err != nil {
+		return 0
+	}
+
+	bytes, _ := strconv.ParseInt(strings.TrimSpace(string(peak)), 10, 64)
+
+	return bytes
+}
+
+// cgroupEvent returns the count of an event from one of a cgroup's events files, zero if it can't be read
+func cgroupEvent(cgroup, file, event string) int {
+	events, err := ioutil.ReadFile(filepath.Join(cgroup, file))
+	if err != nil {
+		return 0
+	}
+
+	for _, line := range strings.Split(string(events), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == event {
+			count, _ := strconv.Atoi(fields[1])
+			return count
+		}
+	}
+
+	return 0
+}
+
+// close removes the run's cgroup once its process has exited
+func (r *runLimits) close() {
+	if r == nil || r.cgroup == "" {
+		return
+	}
+
+	if r.cgroupDir != nil {
+		r.cgroupDir.Close()
+	}
+
+	if err := os.Remove(r.cgroup); err != nil {
+		fmt.Fprintf(os.Stderr, "heimdall: removing cgroup %s: %s\n", r.cgroup, err)
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright 2019 John Darrington johnw.darrington@gmail.com
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+//go:build !linux
+
+package bifrost
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+// limitsSupported reports whether the platform can limit the resources of a run's process
+const limitsSupported = false
+
+// runLimits applies a configuration's limits to a single run, there are none to apply on this platform
+type runLimits struct{}
+
+func (l *limits) enable() {}
+
+func (l *limits) prepare(cmd *exec.Cmd, run runInfo) (*runLimits, error) {
+	return nil, nil
+}
+
+func (r *runLimits) finished(state *os.ProcessState) string {
+	return ""
+}
+
+// ExecLimited is never called, as runs can't be limited
+func ExecLimited(args []string) error {
+	return errors.New("limits are only supported on Linux")
+}
+
+func (r *runLimits) cgroupPath() string {
+	return ""
+}
+
+func (r *runLimits) peakMemory() int64 {
+	return 0
+}
+
+func (r *runLimits) close() {}
@@ -0,0 +1,107 @@
+package bifrost
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestMain has the test binary, which limited runs are started through in heimdall's stead, start their programs
+func TestMain(m *testing.M) {
+	if len(os.Args) > 1 && os.Args[1] == LimitedExecCommand {
+		fmt.Fprintln(os.Stderr, ExecLimited(os.Args[2:]))
+		os.Exit(126)
+	}
+
+	os.Exit(m.Run())
+}
+
+func TestNewLimits(t *testing.T) {
+	for field, config := range map[string]LimitConfig{
+		"Limits.Memory":    {Memory: "lots"},
+		"Limits.CPUTime":   {CPUTime: "-1s"},
+		"Limits.OpenFiles": {OpenFiles: -1},
+		"Limits.Processes": {Processes: -1},
+		"Limits.CPUs":      {CPUs: 0.5},
+	} {
+		_, err := newLimits(ManagerConfig{Limits: config})
+		assert.Equal(t, field, err.(*FieldError).Field, field)
+	}
+
+	limits, err := newLimits(ManagerConfig{})
+	assert.Nil(t, err)
+	assert.False(t, limits.set())
+
+	_, err = newLimits(ManagerConfig{Limits: LimitConfig{OpenFiles: 64}})
+	if limitsSupported {
+		assert.Nil(t, err)
+	} else {
+		assert.Equal(t, "Limits", err.(*FieldError).Field)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	if !limitsSupported {
+		t.Skip("resource limits aren't supported on this platform")
+	}
+
+	summary, err := execute(context.Background(), "", ManagerConfig{
+		AbsolutePath:     "/bin/sh",
+		ProgramArguments: []string{"-c", "while :; do :; done"},
+		Repeat:           1,
+		InParallelCount:  1,
+		Limits:           LimitConfig{CPUTime: "1s"},
+		ReportName:       filepath.Join(t.TempDir(), "report.json"),
+	})
+	assert.Nil(t, err)
+
+	result := summary.results[0]
+	assert.Equal(t, "killed for going over the cpu time limit of 1s", result.Limit)
+	assert.False(t, result.Succeeded())
+}
+
+func TestLimitsFromFirstInstruction(t *testing.T) {
+	if !limitsSupported {
+		t.Skip("resource limits aren't supported on this platform")
+	}
+
+	logName := filepath.Join(t.TempDir(), "heimdall.log")
+
+	// cat reads its own limits before it could be limited by anyone but the process starting it
+	summary, err := execute(context.Background(), "", ManagerConfig{
+		AbsolutePath:     "/bin/cat",
+		ProgramArguments: []string{"/proc/self/limits"},
+		Repeat:           1,
+		InParallelCount:  1,
+		Log:              true,
+		LogName:          logName,
+		Limits:           LimitConfig{OpenFiles: 64, CPUTime: "10s"},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, summary.total.Succeeded)
+
+	content, _ := ioutil.ReadFile(logName)
+	assert.Regexp(t, `Max open files +64 +64 +files`, string(content))
+	assert.Regexp(t, `Max cpu time +10 +11 +seconds`, string(content))
+
+	// the program's arguments reach it untouched, flags included
+	_, err = execute(context.Background(), "", ManagerConfig{
+		AbsolutePath:     "/bin/sh",
+		ProgramArguments: []string{"-c", `echo "$0 $1 $` + EnvRunID + `"`, "name", "--help"},
+		Repeat:           1,
+		InParallelCount:  1,
+		Log:              true,
+		LogName:          logName,
+		LogOverwrite:     true,
+		Limits:           LimitConfig{OpenFiles: 64},
+	})
+	assert.Nil(t, err)
+
+	content, _ = ioutil.ReadFile(logName)
+	assert.Contains(t, string(content), "name --help 1\n")
+}
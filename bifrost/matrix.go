@@ -0,0 +1,187 @@
+// Copyright 2019 John Darrington johnw.darrington@gmail.com
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package bifrost
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Matrix describes a parameter sweep. Every combination of its axes' values becomes a cell and each cell is run
+// Repeat times across the parallel worker pool. A cell's values are available to argument templates through
+// .Params, e.g "--size={{.Params.size}}", and to the program as HEIMDALL_PARAM_<NAME> environment variables.
+// Parameter names are case insensitive and always lower cased, as configuration file keys are.
+type Matrix struct {
+	Axes []MatrixAxis
+
+	// Include adds combinations to the matrix, Exclude removes every combination of the axes matching all of an
+	// entry's values. Included combinations are never excluded.
+	Include []map[string]string
+	Exclude []map[string]string
+}
+
+// MatrixAxis is a single named parameter of a matrix and the values it takes
+type MatrixAxis struct {
+	Name   string
+	Values []string
+}
+
+// matrixCell is a single combination of matrix values
+type matrixCell struct {
+	Name   string
+	Params map[string]string
+}
+
+// validate makes sure every axis is named and has at least one value
+func (matrix *Matrix) validate() error {
+	if matrix == nil {
+		return nil
+	}
+
+	if len(matrix.Axes) == 0 && len(matrix.Include) == 0 {
+		return errors.New("matrix must define at least one axis or included combination")
+	}
+
+	names := map[string]bool{}
+	for _, axis := range matrix.Axes {
+		if axis.Name == "" {
+			return errors.New("matrix axes must be named")
+		}
+
+		if names[strings.ToLower(axis.Name)] {
+			return fmt.Errorf("matrix axis %q defined twice", axis.Name)
+		}
+
+		if len(axis.Values) == 0 {
+			return fmt.Errorf("matrix axis %q has no values", axis.Name)
+		}
+
+		names[strings.ToLower(axis.Name)] = true
+	}
+
+	return nil
+}
+
+// cells expands the matrix into every combination of its axes, minus the excluded combinations and plus the included
+// ones. Exclude never removes an included combination. A nil matrix expands into a single cell without parameters.
+func (matrix *Matrix) cells() []matrixCell {
+	if matrix == nil {
+		return []matrixCell{{}}
+	}
+
+	combinations := []map[string]string{}
+	if len(matrix.Axes) > 0 {
+		combinations = append(combinations, map[string]string{})
+	}
+
+	for _, axis := range matrix.Axes {
+		var expanded []map[string]string
+
+		for _, combination := range combinations {
+			for _, value := range axis.Values {
+				params := map[string]string{strings.ToLower(axis.Name): value}
+				for k, v := range combination {
+					params[k] = v
+				}
+
+				expanded = append(expanded, params)
+			}
+		}
+
+		combinations = expanded
+	}
+
+	var cells []matrixCell
+	seen := map[string]bool{}
+
+	add := func(params map[string]string) {
+		cell := matrixCell{Name: matrix.cellName(params), Params: params}
+		if seen[cell.Name] {
+			return
+		}
+
+		seen[cell.Name] = true
+		cells = append(cells, cell)
+	}
+
+	// as with GitHub Actions matrices, Exclude only removes combinations of the axes and Include is applied after
+combinations:
+	for _, params := range combinations {
+		for _, exclude := range matrix.Exclude {
+			if matchesParams(params, lowerParams(exclude)) {
+				continue combinations
+			}
+		}
+
+		add(params)
+	}
+
+	for _, params := range matrix.Include {
+		add(lowerParams(params))
+	}
+
+	return cells
+}
+
+// cellName formats a cell's parameters in axis order, followed by any extra parameters from Include sorted by name
+func (matrix *Matrix) cellName(params map[string]string) string {
+	var parts []string
+	named := map[string]bool{}
+
+	for _, axis := range matrix.Axes {
+		name := strings.ToLower(axis.Name)
+
+		if value, ok := params[name]; ok {
+			parts = append(parts, name+"="+value)
+			named[name] = true
+		}
+	}
+
+	var extra []string
+	for name := range params {
+		if !named[name] {
+			extra = append(extra, name)
+		}
+	}
+
+	sort.Strings(extra)
+	for _, name := range extra {
+		parts = append(parts, name+"="+params[name])
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// matchesParams reports whether params holds every value in filter
+func matchesParams(params, filter map[string]string) bool {
+	for k, v := range filter {
+		if params[k] != v {
+			return false
+		}
+	}
+
+	return true
+}
+
+func lowerParams(params map[string]string) map[string]string {
+	lowered := make(map[string]string, len(params))
+	for k, v := range params {
+		lowered[strings.ToLower(k)] = v
+	}
+
+	return lowered
+}
@@ -0,0 +1,46 @@
+package bifrost
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatrixCells(t *testing.T) {
+	matrix := &Matrix{
+		Axes: []MatrixAxis{
+			{Name: "size", Values: []string{"1", "2"}},
+			{Name: "threads", Values: []string{"1", "4"}},
+		},
+		Exclude: []map[string]string{{"size": "2", "threads": "4"}},
+		Include: []map[string]string{{"size": "8", "threads": "8", "mode": "fast"}, {"size": "1", "threads": "1"}},
+	}
+
+	assert.Nil(t, matrix.validate())
+
+	var names []string
+	for _, cell := range matrix.cells() {
+		names = append(names, cell.Name)
+	}
+
+	assert.Equal(t, []string{"size=1 threads=1", "size=1 threads=4", "size=2 threads=1", "size=8 threads=8 mode=fast"}, names)
+
+	// an included combination stays even though it matches an exclusion
+	matrix.Include = []map[string]string{{"size": "2", "threads": "4", "mode": "slow"}}
+
+	names = nil
+	for _, cell := range matrix.cells() {
+		names = append(names, cell.Name)
+	}
+
+	assert.Equal(t, []string{"size=1 threads=1", "size=1 threads=4", "size=2 threads=1", "size=2 threads=4 mode=slow"}, names)
+
+	var none *Matrix
+	assert.Equal(t, []matrixCell{{}}, none.cells())
+}
+
+func TestMatrixValidate(t *testing.T) {
+	assert.NotNil(t, (&Matrix{}).validate())
+	assert.NotNil(t, (&Matrix{Axes: []MatrixAxis{{Name: "size"}}}).validate())
+	assert.NotNil(t, (&Matrix{Axes: []MatrixAxis{{Name: "a", Values: []string{"1"}}, {Name: "a", Values: []string{"1"}}}}).validate())
+}
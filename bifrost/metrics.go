@@ -0,0 +1,239 @@
+// Copyright 2019 John Darrington johnw.darrington@gmail.com
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package bifrost
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// durationBuckets are the upper bounds, in seconds, of the run duration histogram - Prometheus's default buckets
+// stretched out to cover runs lasting up to an hour
+var durationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 300, 600, 1800, 3600}
+
+// metrics counts what heimdall's runs did for Prometheus to scrape. A nil metrics counts nothing.
+type metrics struct {
+	lock sync.Mutex
+
+	listener net.Listener
+
+	started  int64
+	finished map[string]int64
+	inFlight int64
+	timeouts int64
+	restarts int64
+
+	// buckets counts runs per durationBuckets bound, not cumulatively
+	buckets       []int64
+	durationCount int64
+	durationSum   float64
+
+	// bytes, lines and matches are keyed by stream
+	bytes   map[string]int64
+	lines   map[string]int64
+	matches map[string]int64
+}
+
+// metricsServers holds the metrics served on every address, so executions sharing an address, such as a watch's
+// iterations or a pipeline's jobs, add to the same metrics
+var metricsServers = struct {
+	lock    sync.Mutex
+	servers map[string]*metrics
+}{servers: map[string]*metrics{}}
+
+// serveMetrics returns the metrics served on addr, listening on it first when nothing is served there yet. Nil is
+// returned for an empty address.
+func serveMetrics(addr string) (*metrics, error) {
+	if addr == "" {
+		return nil, nil
+	}
+
+	metricsServers.lock.Lock()
+	defer metricsServers.lock.Unlock()
+
+	if m, ok := metricsServers.servers[addr]; ok {
+		return m, nil
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("serving metrics: %s", err)
+	}
+
+	m := &metrics{
+		listener: listener,
+		finished: map[string]int64{},
+		buckets:  make([]int64, len(durationBuckets)),
+		bytes:    map[string]int64{},
+		lines:    map[string]int64{},
+		matches:  map[string]int64{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		m.write(w)
+	})
+
+	go http.Serve(listener, mux)
+
+	metricsServers.servers[addr] = m
+
+	return m, nil
+}
+
+// runStarted counts a run whose program was started
+func (m *metrics) runStarted() {
+	if m == nil {
+		return
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.started++
+	m.inFlight++
+}
+
+// runExited counts a started run's program exiting
+func (m *metrics) runExited(duration time.Duration, timedOut bool) {
+	if m == nil {
+		return
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.inFlight--
+
+	if timedOut {
+		m.timeouts++
+	}
+
+	seconds := duration.Seconds()
+	for i, bound := range durationBuckets {
+		if seconds <= bound {
+			m.buckets[i]++
+			break
+		}
+	}
+
+	m.durationCount++
+	m.durationSum += seconds
+}
+
+// runFinished counts a run by its outcome, whether or not its program was started
+func (m *metrics) runFinished(result runResult) {
+	if m == nil {
+		return
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.finished[result.outcome()]++
+}
+
+// output counts a line a run wrote to stream, matched telling whether it matched the LogFilter
+func (m *metrics) output(stream string, line string, matched bool) {
+	if m == nil {
+		return
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.bytes[stream] += int64(len(line))
+	m.lines[stream]++
+
+	if matched {
+		m.matches[stream]++
+	}
+}
+
+// restarted counts the program being restarted
+func (m *metrics) restarted() {
+	if m == nil {
+		return
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.restarts++
+}
+
+// write writes the metrics in the Prometheus text exposition format
+func (m *metrics) write(w io.Writer) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	metric := func(name, kind, help string) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	}
+
+	labelled := func(name, label string, values map[string]int64) {
+		keys := make([]string, 0, len(values))
+		for key := range values {
+			keys = append(keys, key)
+		}
+
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			fmt.Fprintf(w, "%s{%s=%q} %d\n", name, label, key, values[key])
+		}
+	}
+
+	metric("heimdall_runs_started_total", "counter", "Runs whose program was started.")
+	fmt.Fprintf(w, "heimdall_runs_started_total %d\n", m.started)
+
+	metric("heimdall_runs_finished_total", "counter", "Runs finished, by outcome.")
+	labelled("heimdall_runs_finished_total", "outcome", m.finished)
+
+	metric("heimdall_runs_in_flight", "gauge", "Programs currently running.")
+	fmt.Fprintf(w, "heimdall_runs_in_flight %d\n", m.inFlight)
+
+	metric("heimdall_run_duration_seconds", "histogram", "How long started runs' programs took to exit.")
+	var cumulative int64
+	for i, bound := range durationBuckets {
+		cumulative += m.buckets[i]
+		fmt.Fprintf(w, "heimdall_run_duration_seconds_bucket{le=\"%g\"} %d\n", bound, cumulative)
+	}
+
+	fmt.Fprintf(w, "heimdall_run_duration_seconds_bucket{le=\"+Inf\"} %d\n", m.durationCount)
+	fmt.Fprintf(w, "heimdall_run_duration_seconds_sum %g\n", m.durationSum)
+	fmt.Fprintf(w, "heimdall_run_duration_seconds_count %d\n", m.durationCount)
+
+	metric("heimdall_output_bytes_total", "counter", "Bytes of output written by runs, by stream.")
+	labelled("heimdall_output_bytes_total", "stream", m.bytes)
+
+	metric("heimdall_output_lines_total", "counter", "Lines of output written by runs, by stream.")
+	labelled("heimdall_output_lines_total", "stream", m.lines)
+
+	metric("heimdall_filter_matches_total", "counter", "Lines of output matching the log filter, by stream.")
+	labelled("heimdall_filter_matches_total", "stream", m.matches)
+
+	metric("heimdall_timeouts_total", "counter", "Runs killed for going over their timeout.")
+	fmt.Fprintf(w, "heimdall_timeouts_total %d\n", m.timeouts)
+
+	metric("heimdall_restarts_total", "counter", "Times the program was restarted.")
+	fmt.Fprintf(w, "heimdall_restarts_total %d\n", m.restarts)
+}
@@ -0,0 +1,56 @@
+package bifrost
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	config := ManagerConfig{
+		AbsolutePath:     "/bin/sh",
+		ProgramArguments: []string{"-c", "echo found; echo lost; echo found >&2; exit {{.Repetition}}"},
+		Repeat:           2,
+		InParallelCount:  1,
+		LogFilter:        regexp.MustCompile("found"),
+		MetricsAddr:      "127.0.0.1:0",
+	}
+
+	_, err := execute(context.Background(), "", config)
+	assert.Nil(t, err)
+
+	// a second execution on the same address adds to the same metrics
+	metrics, err := serveMetrics(config.MetricsAddr)
+	assert.Nil(t, err)
+
+	response, err := http.Get("http://" + metrics.listener.Addr().String() + "/metrics")
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	defer response.Body.Close()
+
+	body, err := ioutil.ReadAll(response.Body)
+	assert.Nil(t, err)
+
+	for _, line := range []string{
+		"heimdall_runs_started_total 2",
+		`heimdall_runs_finished_total{outcome="failed"} 1`,
+		`heimdall_runs_finished_total{outcome="succeeded"} 1`,
+		"heimdall_runs_in_flight 0",
+		`heimdall_run_duration_seconds_bucket{le="+Inf"} 2`,
+		"heimdall_run_duration_seconds_count 2",
+		`heimdall_output_bytes_total{stream="stdout"} 22`,
+		`heimdall_output_lines_total{stream="stderr"} 2`,
+		`heimdall_output_lines_total{stream="stdout"} 4`,
+		`heimdall_filter_matches_total{stream="stdout"} 2`,
+		"heimdall_timeouts_total 0",
+		"# TYPE heimdall_run_duration_seconds histogram",
+	} {
+		assert.Contains(t, string(body), line+"\n")
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2019 John Darrington johnw.darrington@gmail.com
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+//go:build linux
+
+package bifrost
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// peakInterval is how often a run's peak memory is read while it runs
+const peakInterval = 100 * time.Millisecond
+
+// peakMemory follows the peak resident memory of a run's process. Linux's rusage can't tell it, as it counts the
+// memory of heimdall, which the program was started from, as well. VmHWM in /proc/<pid>/status is the process's own
+// high water mark instead, so reading it periodically only misses growth during the run's last interval. Processes
+// the program started aren't counted.
+type peakMemory struct {
+	peak int64
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// trackPeakMemory starts following the peak memory of the process pid
+func trackPeakMemory(pid int) *peakMemory {
+	p := &peakMemory{done: make(chan struct{})}
+	p.peak, _ = highWater(pid)
+
+	p.wg.Add(1)
+
+	go func() {
+		defer p.wg.Done()
+
+		ticker := time.NewTicker(peakInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-p.done:
+				return
+			case <-ticker.C:
+			}
+
+			// an exited process has no memory left to report, reading ends before its pid could be reused
+			peak, ok := highWater(pid)
+			if !ok {
+				return
+			}
+
+			if peak > p.peak {
+				p.peak = peak
+			}
+		}
+	}()
+
+	return p
+}
+
+// stop ends following the process, returning the highest peak seen
+func (p *peakMemory) stop() int64 {
+	close(p.done)
+	p.wg.Wait()
+
+	return p.peak
+}
+
+// highWater reads a process's VmHWM, false once the process exited
+func highWater(pid int) (int64, bool) {
+	f, err := os.Open(filepath.Join("/proc", strconv.Itoa(pid), "status"))
+	if err != nil {
+		return 0, false
+	}
+
+	defer f.Close()
+
+	lines := bufio.NewScanner(f)
+	for lines.Scan() {
+		fields := strings.Fields(lines.Text())
+		if len(fields) == 3 && fields[0] == "VmHWM:" && fields[2] == "kB" {
+			kilobytes, err := strconv.ParseInt(fields[1], 10, 64)
+			return kilobytes * 1024, err == nil
+		}
+	}
+
+	return 0, false
+}
@@ -0,0 +1,28 @@
+// Copyright 2019 John Darrington johnw.darrington@gmail.com
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+//go:build !linux
+
+package bifrost
+
+// peakMemory is only needed where rusage misreports a run's peak memory, which is the case on Linux alone
+type peakMemory struct{}
+
+func trackPeakMemory(pid int) *peakMemory {
+	return nil
+}
+
+func (p *peakMemory) stop() int64 {
+	return 0
+}
@@ -0,0 +1,187 @@
+// Copyright 2019 John Darrington johnw.darrington@gmail.com
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package bifrost
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// JobStatus is the outcome of a job run as part of a pipeline
+type JobStatus string
+
+// Possible outcomes of a job run as part of a pipeline
+const (
+	JobSucceeded JobStatus = "succeeded"
+	JobFailed    JobStatus = "failed"
+	JobSkipped   JobStatus = "skipped"
+)
+
+// JobResult is the outcome of a single job in a pipeline. Reason explains why a job failed or was skipped.
+type JobResult struct {
+	Name   string
+	Status JobStatus
+	Reason string
+}
+
+// ErrPipelineFailed is returned by ExecutePipeline when any job failed or was skipped. A job fails when any of its runs
+// did, as Execute does.
+var ErrPipelineFailed = errors.New("pipeline failed")
+
+// ExecutePipeline runs jobs as a pipeline. A job starts once every job it DependsOn has succeeded, jobs without
+// dependencies between them run concurrently. A job whose dependency failed or was skipped is skipped. Every job
+// depended upon must be part of jobs, see SelectJobs. The results are returned in the order of jobs and reported
+// on stdout once all jobs are done.
+func ExecutePipeline(jobs []Job) ([]JobResult, error) {
+	if err := checkDependencies(jobs); err != nil {
+		return nil, err
+	}
+
+	// job names are case insensitive, so jobs are tracked by their lower cased names
+	results := make([]JobResult, len(jobs))
+	done := make(map[string]chan struct{}, len(jobs))
+	statuses := make(map[string]*JobResult, len(jobs))
+
+	for i, job := range jobs {
+		done[strings.ToLower(job.Name)] = make(chan struct{})
+		results[i] = JobResult{Name: job.Name}
+		statuses[strings.ToLower(job.Name)] = &results[i]
+	}
+
+	wg := sync.WaitGroup{}
+	for _, job := range jobs {
+		wg.Add(1)
+
+		go func(job Job) {
+			defer wg.Done()
+			defer close(done[strings.ToLower(job.Name)])
+
+			result := statuses[strings.ToLower(job.Name)]
+
+			for _, dependency := range job.Config.DependsOn {
+				dependency = strings.ToLower(dependency)
+				<-done[dependency]
+
+				if statuses[dependency].Status != JobSucceeded {
+					result.Status = JobSkipped
+					result.Reason = fmt.Sprintf("dependency %s %s", statuses[dependency].Name, statuses[dependency].Status)
+					return
+				}
+			}
+
+			summary, err := execute(context.Background(), job.Name, job.Config)
+
+			switch {
+			case err != nil:
+				result.Status = JobFailed
+				result.Reason = err.Error()
+			case summary.failed():
+				result.Status = JobFailed
+				result.Reason = ErrRunsFailed.Error()
+			default:
+				result.Status = JobSucceeded
+			}
+		}(job)
+	}
+
+	wg.Wait()
+
+	reportPipeline(os.Stdout, results)
+
+	for _, result := range results {
+		if result.Status != JobSucceeded {
+			return results, ErrPipelineFailed
+		}
+	}
+
+	return results, nil
+}
+
+// reportPipeline writes the outcome of every job in a pipeline
+func reportPipeline(w io.Writer, results []JobResult) {
+	counts := map[JobStatus]int{}
+	for _, result := range results {
+		counts[result.Status]++
+	}
+
+	fmt.Fprintf(w, "heimdall: pipeline finished - %d succeeded, %d failed, %d skipped\n",
+		counts[JobSucceeded], counts[JobFailed], counts[JobSkipped])
+
+	for _, result := range results {
+		if result.Reason != "" {
+			fmt.Fprintf(w, "  %s %s (%s)\n", result.Name, result.Status, result.Reason)
+		} else {
+			fmt.Fprintf(w, "  %s %s\n", result.Name, result.Status)
+		}
+	}
+}
+
+// checkDependencies makes sure every dependency is part of jobs and that no job depends on itself, even indirectly
+func checkDependencies(jobs []Job) error {
+	byName := make(map[string]Job, len(jobs))
+	for _, job := range jobs {
+		byName[strings.ToLower(job.Name)] = job
+	}
+
+	for _, job := range jobs {
+		for _, dependency := range job.Config.DependsOn {
+			if _, ok := byName[strings.ToLower(dependency)]; !ok {
+				return fmt.Errorf("job %q depends on unknown job %q", job.Name, dependency)
+			}
+		}
+	}
+
+	const (
+		visiting = 1
+		visited  = 2
+	)
+
+	state := map[string]int{}
+
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		name = strings.ToLower(name)
+
+		switch state[name] {
+		case visiting:
+			return fmt.Errorf("job dependency cycle: %s", strings.Join(append(path, name), " -> "))
+		case visited:
+			return nil
+		}
+
+		state[name] = visiting
+		for _, dependency := range byName[name].Config.DependsOn {
+			if err := visit(dependency, append(path, name)); err != nil {
+				return err
+			}
+		}
+		state[name] = visited
+
+		return nil
+	}
+
+	for _, job := range jobs {
+		if err := visit(job.Name, nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,57 @@
+package bifrost
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecutePipeline(t *testing.T) {
+	program := func(path string, dependsOn ...string) ManagerConfig {
+		return ManagerConfig{AbsolutePath: path, Repeat: 1, InParallelCount: 1, DependsOn: dependsOn}
+	}
+
+	jobs := []Job{
+		{Name: "seed", Config: program("/bin/true")},
+		{Name: "broken", Config: program("/bin/false")},
+		{Name: "load", Config: program("/bin/true", "seed")},
+		{Name: "report", Config: program("/bin/true", "load", "broken")},
+	}
+
+	results, err := ExecutePipeline(jobs)
+	assert.Equal(t, ErrPipelineFailed, err)
+
+	var statuses []JobStatus
+	for _, result := range results {
+		statuses = append(statuses, result.Status)
+	}
+
+	assert.Equal(t, []JobStatus{JobSucceeded, JobFailed, JobSucceeded, JobSkipped}, statuses)
+}
+
+func TestExecuteFailedRuns(t *testing.T) {
+	config := ManagerConfig{AbsolutePath: "/bin/false", Repeat: 1, InParallelCount: 1}
+
+	// a single job fails on failed runs just like a pipeline job does
+	assert.Equal(t, ErrRunsFailed, Execute(config))
+
+	config.AbsolutePath = "/bin/true"
+	assert.Nil(t, Execute(config))
+}
+
+func TestCheckDependencies(t *testing.T) {
+	assert.NotNil(t, checkDependencies([]Job{{Name: "a", Config: ManagerConfig{DependsOn: []string{"missing"}}}}))
+
+	assert.NotNil(t, checkDependencies([]Job{
+		{Name: "a", Config: ManagerConfig{DependsOn: []string{"b"}}},
+		{Name: "b", Config: ManagerConfig{DependsOn: []string{"a"}}},
+	}))
+
+	selected, err := SelectJobs([]Job{
+		{Name: "a", Config: ManagerConfig{DependsOn: []string{"b"}}},
+		{Name: "b"},
+		{Name: "c"},
+	}, []string{"a"}, false)
+	assert.Nil(t, err)
+	assert.Len(t, selected, 2)
+}
@@ -0,0 +1,189 @@
+// Copyright 2019 John Darrington johnw.darrington@gmail.com
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package bifrost
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Ramp shapes deciding how concurrency moves between the stages of a ramp
+const (
+	// RampStep holds each stage's concurrency for the whole stage, this is the default
+	RampStep = "step"
+	// RampLinear moves concurrency linearly from the previous stage's to the stage's own over the stage
+	RampLinear = "linear"
+)
+
+// RampConfig starts instances gradually rather than all InParallelCount at once, InParallelCount being the most
+// instances a ramp ever runs at once. Either start Start instances and add Step more every Interval, Interval being
+// a Go duration such as "30s" and Start defaulting to Step, or follow Stages.
+//
+// Stages make up a concurrency curve, each stage lasting its Duration. Shape decides whether concurrency jumps to
+// each stage's straight away, see RampStep, or moves towards it over the stage, see RampLinear, starting from
+// Start. Unless For or Until is set the execution lasts as long as its stages and Repeat is ignored.
+type RampConfig struct {
+	Start    int
+	Step     int
+	Interval string
+
+	Stages []RampStage
+	Shape  string
+}
+
+// RampStage is a single stage of a ramp, see RampConfig
+type RampStage struct {
+	Duration    string
+	Concurrency int
+}
+
+// ramp computes how many instances may run at a time over the course of an execution
+type ramp struct {
+	start    int
+	step     int
+	interval time.Duration
+	max      int
+
+	stages []rampStage
+	linear bool
+}
+
+type rampStage struct {
+	duration    time.Duration
+	concurrency int
+}
+
+// newRamp parses a configuration's ramp, returning nil when instances aren't ramped
+func newRamp(config ManagerConfig) (*ramp, error) {
+	ramped := config.Ramp
+	r := &ramp{start: ramped.Start, step: ramped.Step, max: config.InParallelCount}
+
+	if ramped.Start < 0 {
+		return nil, &FieldError{Field: "Ramp.Start", Err: errors.New("must not be negative")}
+	}
+
+	if ramped.Step < 0 {
+		return nil, &FieldError{Field: "Ramp.Step", Err: errors.New("must not be negative")}
+	}
+
+	if ramped.Interval != "" {
+		interval, err := time.ParseDuration(ramped.Interval)
+		if err != nil {
+			return nil, &FieldError{Field: "Ramp.Interval", Err: err}
+		}
+
+		r.interval = interval
+	}
+
+	if ramped.Step > 0 && r.interval <= 0 {
+		return nil, &FieldError{Field: "Ramp.Interval", Err: errors.New("must be set to a positive duration along with Step")}
+	}
+
+	if ramped.Step > 0 && len(ramped.Stages) > 0 {
+		return nil, &FieldError{Field: "Ramp", Err: errors.New("only one of Step and Stages may be set")}
+	}
+
+	for i, stage := range ramped.Stages {
+		duration, err := time.ParseDuration(stage.Duration)
+		if err != nil {
+			return nil, &FieldError{Field: fmt.Sprintf("Ramp.Stages[%d].Duration", i), Err: err}
+		}
+
+		if duration <= 0 {
+			return nil, &FieldError{Field: fmt.Sprintf("Ramp.Stages[%d].Duration", i), Err: errors.New("must be positive")}
+		}
+
+		if stage.Concurrency < 0 || stage.Concurrency > config.InParallelCount {
+			return nil, &FieldError{Field: fmt.Sprintf("Ramp.Stages[%d].Concurrency", i),
+				Err: fmt.Errorf("must be between 0 and InParallelCount, %d", config.InParallelCount)}
+		}
+
+		r.stages = append(r.stages, rampStage{duration: duration, concurrency: stage.Concurrency})
+	}
+
+	switch ramped.Shape {
+	case "", RampStep:
+	case RampLinear:
+		r.linear = true
+	default:
+		return nil, &FieldError{Field: "Ramp.Shape", Err: fmt.Errorf("unknown shape %q, expected %q or %q",
+			ramped.Shape, RampStep, RampLinear)}
+	}
+
+	if r.step == 0 && len(r.stages) == 0 {
+		return nil, nil
+	}
+
+	if r.start == 0 && r.step > 0 {
+		r.start = r.step
+	}
+
+	return r, nil
+}
+
+// length is how long the ramp's stages last, zero when it has none
+func (r *ramp) length() time.Duration {
+	var length time.Duration
+	for _, stage := range r.stages {
+		length += stage.duration
+	}
+
+	return length
+}
+
+// level returns how many instances may run at once elapsed into the execution. Once the stages are over the last
+// stage's concurrency is kept.
+func (r *ramp) level(elapsed time.Duration) int {
+	if len(r.stages) == 0 {
+		return minInt(r.start+r.step*int(elapsed/r.interval), r.max)
+	}
+
+	previous := minInt(r.start, r.max)
+	for _, stage := range r.stages {
+		if elapsed >= stage.duration {
+			elapsed -= stage.duration
+			previous = stage.concurrency
+			continue
+		}
+
+		if !r.linear {
+			return stage.concurrency
+		}
+
+		progress := float64(elapsed) / float64(stage.duration)
+		return previous + int(math.Round(float64(stage.concurrency-previous)*progress))
+	}
+
+	return previous
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
+
+// runRamped runs every queued run like runWorkers, starting a run only while fewer runs are going than the ramp's
+// current level allows
+func (m *manager) runRamped(ctx context.Context, queue <-chan runSpec) {
+	m.dispatch(ctx, queue, func() int {
+		return m.ramp.level(time.Since(m.summary.started))
+	})
+}
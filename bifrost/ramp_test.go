@@ -0,0 +1,58 @@
+package bifrost
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewRamp(t *testing.T) {
+	r, err := newRamp(ManagerConfig{InParallelCount: 4})
+	assert.Nil(t, err)
+	assert.Nil(t, r)
+
+	_, err = newRamp(ManagerConfig{InParallelCount: 4, Ramp: RampConfig{Step: 1}})
+	assert.Equal(t, "Ramp.Interval", err.(*FieldError).Field)
+
+	_, err = newRamp(ManagerConfig{InParallelCount: 4, Ramp: RampConfig{Step: 1, Interval: "1s", Stages: []RampStage{{"1m", 2}}}})
+	assert.Equal(t, "Ramp", err.(*FieldError).Field)
+
+	_, err = newRamp(ManagerConfig{InParallelCount: 4, Ramp: RampConfig{Stages: []RampStage{{"1m", 2}, {"1m", 8}}}})
+	assert.Equal(t, "Ramp.Stages[1].Concurrency", err.(*FieldError).Field)
+
+	_, err = newRamp(ManagerConfig{InParallelCount: 4, Ramp: RampConfig{Stages: []RampStage{{"a minute", 2}}}})
+	assert.Equal(t, "Ramp.Stages[0].Duration", err.(*FieldError).Field)
+
+	_, err = newRamp(ManagerConfig{InParallelCount: 4, Ramp: RampConfig{Stages: []RampStage{{"1m", 2}}, Shape: "smooth"}})
+	assert.Equal(t, "Ramp.Shape", err.(*FieldError).Field)
+}
+
+func TestRampLevel(t *testing.T) {
+	r, err := newRamp(ManagerConfig{InParallelCount: 10, Ramp: RampConfig{Step: 4, Interval: "1m"}})
+	assert.Nil(t, err)
+
+	assert.Equal(t, 4, r.level(0))
+	assert.Equal(t, 4, r.level(59*time.Second))
+	assert.Equal(t, 8, r.level(time.Minute))
+	assert.Equal(t, 10, r.level(time.Hour))
+
+	stages := []RampStage{{"1m", 4}, {"1m", 8}, {"2m", 0}}
+
+	r, err = newRamp(ManagerConfig{InParallelCount: 8, Ramp: RampConfig{Stages: stages}})
+	assert.Nil(t, err)
+
+	assert.Equal(t, 4*time.Minute, r.length())
+	assert.Equal(t, 4, r.level(30*time.Second))
+	assert.Equal(t, 8, r.level(90*time.Second))
+	assert.Equal(t, 0, r.level(5*time.Minute))
+
+	r, err = newRamp(ManagerConfig{InParallelCount: 8, Ramp: RampConfig{Stages: stages, Shape: RampLinear}})
+	assert.Nil(t, err)
+
+	assert.Equal(t, 0, r.level(0))
+	assert.Equal(t, 2, r.level(30*time.Second))
+	assert.Equal(t, 6, r.level(90*time.Second))
+	assert.Equal(t, 4, r.level(3*time.Minute))
+	assert.Equal(t, 0, r.level(5*time.Minute))
+}
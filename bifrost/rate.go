@@ -0,0 +1,114 @@
+// Copyright 2019 John Darrington johnw.darrington@gmail.com
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package bifrost
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// rateSummary tells how well a target rate was sustained, it is part of the summary and report of an execution
+// started at a rate
+type rateSummary struct {
+	Target   float64
+	Achieved float64
+	Arrivals int
+	Missed   int
+
+	started int
+	elapsed time.Duration
+}
+
+func (r *rateSummary) String() string {
+	return fmt.Sprintf("%.2f runs/s targeted, %.2f achieved, %d of %d arrivals missed as every instance was busy",
+		r.Target, r.Achieved, r.Missed, r.Arrivals)
+}
+
+// rateInterval returns the time between arrivals at a configuration's Rate, zero when runs aren't started at a rate
+func rateInterval(config ManagerConfig) (time.Duration, error) {
+	if config.Rate < 0 {
+		return 0, &FieldError{Field: "Rate", Err: errors.New("must not be negative")}
+	}
+
+	if config.Rate == 0 {
+		return 0, nil
+	}
+
+	if config.Ramp.Step > 0 || len(config.Ramp.Stages) > 0 {
+		return 0, &FieldError{Field: "Rate", Err: errors.New("only one of Rate and Ramp may be set")}
+	}
+
+	interval := time.Duration(float64(time.Second) / config.Rate)
+	if interval <= 0 {
+		return 0, &FieldError{Field: "Rate", Err: errors.New("too high")}
+	}
+
+	return interval, nil
+}
+
+// runAtRate starts a queued run at every arrival, an arrival being due every interval whether or not earlier runs
+// have finished. An arrival finding as many runs going as the parallelism allows is missed, its run dropped rather
+// than delayed. Every run is given the lowest free instance number.
+func (m *manager) runAtRate(ctx context.Context, interval time.Duration, queue <-chan runSpec) {
+	wg := sync.WaitGroup{}
+	slots := newInstanceSlots()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	started := time.Now()
+	arrivals, missed := 0, 0
+
+	for spec := range queue {
+		// the first arrival is due straight away
+		if arrivals > 0 {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+			case <-m.stop:
+			}
+		}
+
+		// runs still queued once no more may be started are dropped
+		if m.stopped(ctx) {
+			continue
+		}
+
+		arrivals++
+
+		if slots.active() >= m.control.parallelism() {
+			missed++
+			continue
+		}
+
+		run := m.newRun(slots.take(), spec)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			m.runOnce(ctx, run)
+			slots.release(run.Instance)
+		}()
+	}
+
+	// the last arrival's interval counts towards the time taken as much as the first's
+	m.summary.recordArrivals(arrivals, missed, time.Since(started)+interval)
+
+	wg.Wait()
+}
@@ -0,0 +1,42 @@
+package bifrost
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateInterval(t *testing.T) {
+	interval, err := rateInterval(ManagerConfig{})
+	assert.Nil(t, err)
+	assert.Zero(t, interval)
+
+	interval, err = rateInterval(ManagerConfig{Rate: 4})
+	assert.Nil(t, err)
+	assert.Equal(t, 250*time.Millisecond, interval)
+
+	_, err = rateInterval(ManagerConfig{Rate: -1})
+	assert.Equal(t, "Rate", err.(*FieldError).Field)
+
+	_, err = rateInterval(ManagerConfig{Rate: 4, Ramp: RampConfig{Step: 1, Interval: "1s"}})
+	assert.Equal(t, "Rate", err.(*FieldError).Field)
+}
+
+func TestRunAtRate(t *testing.T) {
+	// a run takes longer than the time between arrivals, so a single instance can't keep up
+	summary, err := execute(context.Background(), "", ManagerConfig{
+		AbsolutePath:     "/bin/sleep",
+		ProgramArguments: []string{"0.15"},
+		Repeat:           10,
+		InParallelCount:  1,
+		Rate:             20,
+	})
+	assert.Nil(t, err)
+
+	assert.Equal(t, 10, summary.rate.Arrivals)
+	assert.True(t, summary.rate.Missed > 0)
+	assert.Equal(t, 10-summary.rate.Missed, summary.total.Runs)
+	assert.True(t, summary.rate.Achieved < 20)
+}
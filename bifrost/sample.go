@@ -0,0 +1,186 @@
+// Copyright 2019 John Darrington johnw.darrington@gmail.com
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package bifrost
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultGrowth is the percentage a run's memory must grow by before it's flagged, unless SamplingConfig says
+// otherwise
+const DefaultGrowth = 20
+
+// growthSamples is the fewest samples a run needs before its memory growth is judged
+const growthSamples = 6
+
+// SamplingConfig samples every running process, along with the processes it started, from /proc while it runs.
+// Interval is how often, as a Go duration - e.g "500ms". Each sample holds the resident memory, CPU percentage,
+// threads, open files and processes of the run's process tree and is written to the report. A run whose memory grew
+// by more than Growth percent between the first and last third of its samples is flagged, Growth defaulting to 20.
+// Sampling is only supported on Linux.
+type SamplingConfig struct {
+	Interval string
+	Growth   float64
+}
+
+// sample is the resources a run's process tree held at one point during the run
+type sample struct {
+	Seconds    float64
+	RSSBytes   int64
+	CPUPercent float64
+	Threads    int
+	OpenFiles  int
+	Processes  int
+}
+
+// sampling holds a configuration's parsed SamplingConfig
+type sampling struct {
+	interval time.Duration
+	growth   float64
+}
+
+// newSampling parses a configuration's Sampling, returning nil when runs aren't sampled
+func newSampling(config ManagerConfig) (*sampling, error) {
+	s := &sampling{growth: DefaultGrowth}
+
+	if config.Sampling.Growth < 0 {
+		return nil, &FieldError{Field: "Sampling.Growth", Err: errors.New("must not be negative")}
+	}
+
+	if config.Sampling.Growth > 0 {
+		s.growth = config.Sampling.Growth
+	}
+
+	if config.Sampling.Interval == "" {
+		return nil, nil
+	}
+
+	interval, err := time.ParseDuration(config.Sampling.Interval)
+	if err != nil {
+		return nil, &FieldError{Field: "Sampling.Interval", Err: err}
+	}
+
+	if interval < 0 {
+		return nil, &FieldError{Field: "Sampling.Interval", Err: errors.New("must not be negative")}
+	}
+
+	if interval == 0 {
+		return nil, nil
+	}
+
+	if !samplingSupported {
+		return nil, &FieldError{Field: "Sampling", Err: errors.New("sampling is only supported on Linux")}
+	}
+
+	s.interval = interval
+
+	return s, nil
+}
+
+// sampler samples a single run's process tree until stopped
+type sampler struct {
+	samples []sample
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// start begins sampling the process tree rooted at pid, or the processes of the run's cgroup when not empty,
+// returning nil when runs aren't sampled
+func (s *sampling) start(pid int, cgroup string) *sampler {
+	if s == nil {
+		return nil
+	}
+
+	r := &sampler{done: make(chan struct{})}
+	r.wg.Add(1)
+
+	go func() {
+		defer r.wg.Done()
+
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		started := time.Now()
+		previous := processTicks{}
+		last := started
+
+		for {
+			select {
+			case <-r.done:
+				return
+			case <-ticker.C:
+			}
+
+			// a late tick mustn't inflate the CPU percentage, which is measured against the time since the last sample
+			now := time.Now()
+
+			// sampling ends with the process, before its pid could be reused
+			sampled, ticks, ok := sampleTree(pid, cgroup, previous, now.Sub(last))
+			if !ok {
+				return
+			}
+
+			previous, last = ticks, now
+			sampled.Seconds = now.Sub(started).Seconds()
+			r.samples = append(r.samples, sampled)
+		}
+	}()
+
+	return r
+}
+
+// stop ends sampling if the run's process hasn't ended it already, returning the samples taken
+func (r *sampler) stop() []sample {
+	if r == nil {
+		return nil
+	}
+
+	close(r.done)
+	r.wg.Wait()
+
+	return r.samples
+}
+
+// grew returns how a run's memory grew across its samples when it grew by more than allowed, empty otherwise
+func (s *sampling) grew(samples []sample) string {
+	if s == nil || len(samples) < growthSamples {
+		return ""
+	}
+
+	third := len(samples) / 3
+	first, last := averageRSS(samples[:third]), averageRSS(samples[len(samples)-third:])
+	if first == 0 {
+		return ""
+	}
+
+	grew := (float64(last) - float64(first)) / float64(first) * 100
+	if grew <= s.growth {
+		return ""
+	}
+
+	return fmt.Sprintf("memory grew %.0f%% from %s to %s", grew, formatSize(first), formatSize(last))
+}
+
+func averageRSS(samples []sample) int64 {
+	var total int64
+	for _, s := range samples {
+		total += s.RSSBytes
+	}
+
+	return total / int64(len(samples))
+}
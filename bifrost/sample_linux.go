@@ -0,0 +1,210 @@
+// Copyright 2019 John Darrington johnw.darrington@gmail.com
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+//go:build linux
+
+package bifrost
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// samplingSupported reports whether the platform can sample running processes
+const samplingSupported = true
+
+// clockTicks is the kernel's USER_HZ which /proc reports CPU time in, 100 on every architecture Go supports
+const clockTicks = 100
+
+// processTicks is the CPU time, in clock ticks, every process of a tree had used when it was last sampled
+type processTicks map[int]uint64
+
+// processStat is the part of /proc/<pid>/stat a sample is made of
+type processStat struct {
+	parent   int
+	zombie   bool
+	ticks    uint64
+	threads  int
+	rssPages int64
+}
+
+// sampleTree samples the processes of a run, its CPU percentage measured against the ticks of the previous sample
+// taken elapsed ago. The processes are those of the run's cgroup when it has one, otherwise the process tree rooted
+// at pid. False is returned once the process is gone.
+func sampleTree(pid int, cgroup string, previous processTicks, elapsed time.Duration) (sample, processTicks, bool) {
+	if root, ok := readStat(pid); !ok || root.zombie {
+		return sample{}, nil, false
+	}
+
+	processes := cgroupProcesses(cgroup)
+	if processes == nil {
+		processes = processTree(pid)
+	}
+
+	s := sample{}
+	ticks := processTicks{}
+	var used uint64
+
+	for _, process := range processes {
+		stat, ok := readStat(process)
+		if !ok || stat.zombie {
+			continue
+		}
+
+		// a process which wasn't there last time used all of its ticks since
+		if stat.ticks > previous[process] {
+			used += stat.ticks - previous[process]
+		}
+
+		ticks[process] = stat.ticks
+
+		s.Processes++
+		s.Threads += stat.threads
+		s.RSSBytes += stat.rssPages * int64(os.Getpagesize())
+		s.OpenFiles += openFiles(process)
+	}
+
+	if elapsed > 0 {
+		s.CPUPercent = float64(used) / clockTicks / elapsed.Seconds() * 100
+	}
+
+	return s, ticks, true
+}
+
+// processTree lists the process pid and every process it started, directly or not, from the children each of their
+// threads started. Kernels built without those lists have every process in /proc read for its parent instead.
+func processTree(pid int) []int {
+	if _, err := os.Stat(childrenPath(pid, pid)); err != nil {
+		return scanTree(pid)
+	}
+
+	var processes []int
+
+	for tree := []int{pid}; len(tree) > 0; tree = tree[1:] {
+		process := tree[0]
+		processes = append(processes, process)
+
+		threads, _ := ioutil.ReadDir(filepath.Join("/proc", strconv.Itoa(process), "task"))
+		for _, thread := range threads {
+			task, err := strconv.Atoi(thread.Name())
+			if err != nil {
+				continue
+			}
+
+			children, _ := ioutil.ReadFile(childrenPath(process, task))
+			for _, field := range strings.Fields(string(children)) {
+				if child, err := strconv.Atoi(field); err == nil {
+					tree = append(tree, child)
+				}
+			}
+		}
+	}
+
+	return processes
+}
+
+func childrenPath(pid, task int) string {
+	return filepath.Join("/proc", strconv.Itoa(pid), "task", strconv.Itoa(task), "children")
+}
+
+// scanTree lists the process tree rooted at pid from the parent of every process in /proc
+func scanTree(pid int) []int {
+	children := map[int][]int{}
+
+	entries, _ := ioutil.ReadDir("/proc")
+	for _, entry := range entries {
+		process, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+
+		if stat, ok := readStat(process); ok {
+			children[stat.parent] = append(children[stat.parent], process)
+		}
+	}
+
+	var processes []int
+	for tree := []int{pid}; len(tree) > 0; tree = tree[1:] {
+		processes = append(processes, tree[0])
+		tree = append(tree, children[tree[0]]...)
+	}
+
+	return processes
+}
+
+// cgroupProcesses lists the processes of a run's cgroup, nil without one
+func cgroupProcesses(cgroup string) []int {
+	if cgroup == "" {
+		return nil
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(cgroup, "cgroup.procs"))
+	if err != nil {
+		return nil
+	}
+
+	processes := []int{}
+	for _, field := range strings.Fields(string(content)) {
+		if process, err := strconv.Atoi(field); err == nil {
+			processes = append(processes, process)
+		}
+	}
+
+	return processes
+}
+
+func readStat(pid int) (processStat, bool) {
+	content, err := ioutil.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return processStat{}, false
+	}
+
+	// the command name may hold spaces and parentheses of its own, so fields are counted from the last parenthesis
+	end := strings.LastIndexByte(string(content), ')')
+	if end < 0 {
+		return processStat{}, false
+	}
+
+	// fields starts at the state, the third field of the stat file
+	fields := strings.Fields(string(content[end+1:]))
+	if len(fields) < 22 {
+		return processStat{}, false
+	}
+
+	parent, _ := strconv.Atoi(fields[1])
+	user, _ := strconv.ParseUint(fields[11], 10, 64)
+	system, _ := strconv.ParseUint(fields[12], 10, 64)
+	threads, _ := strconv.Atoi(fields[17])
+	rss, _ := strconv.ParseInt(fields[21], 10, 64)
+
+	return processStat{parent: parent, zombie: fields[0] == "Z", ticks: user + system, threads: threads, rssPages: rss}, true
+}
+
+// openFiles counts a process's open file descriptors, zero when they can't be read
+func openFiles(pid int) int {
+	dir, err := os.Open(filepath.Join("/proc", strconv.Itoa(pid), "fd"))
+	if err != nil {
+		return 0
+	}
+
+	defer dir.Close()
+
+	names, _ := dir.Readdirnames(-1)
+
+	return len(names)
+}
@@ -0,0 +1,104 @@
+package bifrost
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewSampling(t *testing.T) {
+	s, err := newSampling(ManagerConfig{})
+	assert.Nil(t, err)
+	assert.Nil(t, s)
+
+	_, err = newSampling(ManagerConfig{Sampling: SamplingConfig{Interval: "often"}})
+	assert.Equal(t, "Sampling.Interval", err.(*FieldError).Field)
+
+	// the interval flag's default turns sampling off
+	s, err = newSampling(ManagerConfig{Sampling: SamplingConfig{Interval: "0s"}})
+	assert.Nil(t, err)
+	assert.Nil(t, s)
+
+	_, err = newSampling(ManagerConfig{Sampling: SamplingConfig{Interval: "-1s"}})
+	assert.Equal(t, "Sampling.Interval", err.(*FieldError).Field)
+
+	_, err = newSampling(ManagerConfig{Sampling: SamplingConfig{Interval: "1s", Growth: -1}})
+	assert.Equal(t, "Sampling.Growth", err.(*FieldError).Field)
+}
+
+func TestSamplingGrowth(t *testing.T) {
+	s := &sampling{growth: DefaultGrowth}
+
+	samples := func(rss ...int64) []sample {
+		var out []sample
+		for _, r := range rss {
+			out = append(out, sample{RSSBytes: r << 20})
+		}
+
+		return out
+	}
+
+	assert.Equal(t, "", s.grew(samples(10, 20, 30)))
+	assert.Equal(t, "", s.grew(samples(10, 10, 11, 10, 11, 11)))
+	assert.Equal(t, "memory grew 100% from 10.0 MiB to 20.0 MiB", s.grew(samples(10, 10, 14, 16, 20, 20)))
+}
+
+func TestSampling(t *testing.T) {
+	if !samplingSupported {
+		t.Skip("sampling isn't supported on this platform")
+	}
+
+	summary, err := execute(context.Background(), "", ManagerConfig{
+		AbsolutePath:     "/bin/sh",
+		ProgramArguments: []string{"-c", "sleep 0.5 & wait"},
+		Repeat:           1,
+		InParallelCount:  1,
+		Sampling:         SamplingConfig{Interval: "50ms"},
+		ReportName:       filepath.Join(t.TempDir(), "report.json"),
+	})
+	assert.Nil(t, err)
+
+	samples := summary.results[0].Samples
+	if assert.NotEmpty(t, samples) {
+		assert.Equal(t, 2, samples[0].Processes)
+		assert.True(t, samples[0].RSSBytes > 0)
+		assert.True(t, samples[0].Threads >= 2)
+	}
+}
+
+func TestSampleTree(t *testing.T) {
+	if !samplingSupported {
+		t.Skip("sampling isn't supported on this platform")
+	}
+
+	child := exec.Command("/bin/sleep", "1")
+	assert.Nil(t, child.Start())
+
+	defer child.Wait()
+	defer child.Process.Kill()
+
+	assert.Contains(t, processTree(os.Getpid()), child.Process.Pid)
+
+	// a run's cgroup lists every process of the run instead
+	cgroup := t.TempDir()
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(cgroup, "cgroup.procs"), []byte("1\n42\n"), 0644))
+	assert.Equal(t, []int{1, 42}, cgroupProcesses(cgroup))
+
+	// the CPU percentage is measured against the time since the previous sample
+	for busy := time.Now(); time.Since(busy) < 100*time.Millisecond; {
+	}
+
+	sampled, _, ok := sampleTree(os.Getpid(), "", processTicks{}, time.Second)
+	assert.True(t, ok)
+	assert.True(t, sampled.Processes >= 2)
+	assert.True(t, sampled.CPUPercent > 0)
+
+	quicker, _, _ := sampleTree(os.Getpid(), "", processTicks{}, 100*time.Millisecond)
+	assert.True(t, quicker.CPUPercent > 5*sampled.CPUPercent, "%f %f", quicker.CPUPercent, sampled.CPUPercent)
+}
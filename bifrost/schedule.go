@@ -0,0 +1,266 @@
+// Copyright 2019 John Darrington johnw.darrington@gmail.com
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package bifrost
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Overlap policies deciding what happens when a schedule triggers while the previous round is still running
+const (
+	// OverlapSkip drops the new round, this is the default
+	OverlapSkip = "skip"
+	// OverlapQueue starts the new round once the previous one has finished
+	OverlapQueue = "queue"
+	// OverlapConcurrent starts the new round alongside the previous one
+	OverlapConcurrent = "concurrent"
+	// OverlapKill kills the previous round before starting the new one
+	OverlapKill = "kill"
+)
+
+// ScheduleConfig runs the program periodically rather than Repeat times back to back. Every time the schedule
+// triggers a round is run - a single repetition of InParallelCount instances, or of every matrix cell. Set either
+// Every, a Go duration such as "5m", or Cron, a standard cron expression such as "*/5 * * * *" or a descriptor such as
+// "@hourly". An interval schedule runs its first round straight away.
+//
+// Overlap decides what to do when a round is still running as the next is due, see OverlapSkip. Scheduling stops
+// once Count rounds were started or Until has passed, or when heimdall is interrupted. Without either the schedule
+// runs until interrupted.
+type ScheduleConfig struct {
+	Every   string
+	Cron    string
+	Overlap string
+	Count   int
+}
+
+// scheduleSummary counts what a schedule did, it is part of the summary and report of a scheduled execution
+type scheduleSummary struct {
+	Rounds  int
+	Skipped int
+	Killed  int
+}
+
+func (s *scheduleSummary) String() string {
+	return fmt.Sprintf("%d rounds started, %d skipped, %d killed", s.Rounds, s.Skipped, s.Killed)
+}
+
+// trigger computes when a schedule's rounds are due
+type trigger struct {
+	every time.Duration
+	cron  cron.Schedule
+
+	// until is the soak's deadline, if any, after which no round is due
+	until time.Time
+}
+
+// newTrigger parses a configuration's schedule, returning nil when the program isn't scheduled. When it is run as
+// part of a soak, until must be set to the soak's deadline.
+func newTrigger(config ManagerConfig) (*trigger, error) {
+	schedule := config.Schedule
+	t := &trigger{}
+
+	if schedule.Every != "" {
+		every, err := time.ParseDuration(schedule.Every)
+		if err != nil {
+			return nil, &FieldError{Field: "Schedule.Every", Err: err}
+		}
+
+		if every < 0 {
+			return nil, &FieldError{Field: "Schedule.Every", Err: errors.New("must not be negative")}
+		}
+
+		t.every = every
+	}
+
+	if schedule.Cron != "" {
+		if t.every > 0 {
+			return nil, &FieldError{Field: "Schedule", Err: errors.New("only one of Every and Cron may be set")}
+		}
+
+		expression, err := cron.ParseStandard(schedule.Cron)
+		if err != nil {
+			return nil, &FieldError{Field: "Schedule.Cron", Err: err}
+		}
+
+		t.cron = expression
+	}
+
+	switch schedule.Overlap {
+	case "", OverlapSkip, OverlapQueue, OverlapConcurrent, OverlapKill:
+	default:
+		return nil, &FieldError{Field: "Schedule.Overlap", Err: fmt.Errorf("unknown policy %q, expected %q, %q, %q or %q",
+			schedule.Overlap, OverlapSkip, OverlapQueue, OverlapConcurrent, OverlapKill)}
+	}
+
+	if schedule.Count < 0 {
+		return nil, &FieldError{Field: "Schedule.Count", Err: errors.New("must not be negative")}
+	}
+
+	if t.every == 0 && t.cron == nil {
+		return nil, nil
+	}
+
+	return t, nil
+}
+
+// first returns when the first round is due
+func (t *trigger) first(now time.Time) time.Time {
+	if t.cron != nil {
+		return t.cron.Next(now)
+	}
+
+	return now
+}
+
+// next returns when the round following the one due at previous is due. Rounds which would already be overdue by now
+// are left out rather than run in a burst.
+func (t *trigger) next(previous, now time.Time) time.Time {
+	if t.cron != nil {
+		return t.cron.Next(now)
+	}
+
+	next := previous.Add(t.every)
+	for next.Before(now) {
+		next = next.Add(t.every)
+	}
+
+	return next
+}
+
+// done reports whether no round may be due at next
+func (t *trigger) done(next time.Time) bool {
+	return !t.until.IsZero() && next.After(t.until)
+}
+
+// round is a single triggering of a schedule
+type round struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func (r *round) running() bool {
+	select {
+	case <-r.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// runScheduled runs a round every time the schedule triggers, returning once scheduling stopped and every round has
+// finished. Interrupting heimdall stops the schedule and lets running rounds finish. Once ctx is done the schedule
+// stops as well and rounds are killed.
+func (m *manager) runScheduled(ctx context.Context, t *trigger, cells []matrixCell) {
+	config := m.config.Schedule
+	stats := &scheduleSummary{}
+	m.summary.schedule = stats
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+
+	wg := sync.WaitGroup{}
+	var rounds []*round
+
+scheduling:
+	for next := t.first(time.Now()); config.Count == 0 || stats.Rounds < config.Count; next = t.next(next, time.Now()) {
+		if t.done(next) {
+			break
+		}
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-timer.C:
+		case <-interrupt:
+			timer.Stop()
+			fmt.Fprintln(os.Stderr, "heimdall: interrupted, waiting for running rounds to finish")
+			break scheduling
+		case <-ctx.Done():
+			timer.Stop()
+			break scheduling
+		}
+
+		var running []*round
+		for _, r := range rounds {
+			if r.running() {
+				running = append(running, r)
+			}
+		}
+
+		var previous *round
+		if len(running) > 0 {
+			switch config.Overlap {
+			case OverlapQueue:
+				previous = rounds[len(rounds)-1]
+			case OverlapConcurrent:
+			case OverlapKill:
+				for _, r := range running {
+					r.cancel()
+					<-r.done
+					stats.Killed++
+				}
+			default:
+				stats.Skipped++
+				continue
+			}
+		}
+
+		ctx, cancel := context.WithCancel(ctx)
+		r := &round{cancel: cancel, done: make(chan struct{})}
+		rounds = append(rounds, r)
+
+		wg.Add(1)
+		go func(repetition int) {
+			defer wg.Done()
+			defer close(r.done)
+			defer cancel()
+
+			// queued rounds wait for the round before them, which in turn waited for its own
+			if previous != nil {
+				<-previous.done
+			}
+
+			m.runRound(ctx, repetition, cells)
+		}(stats.Rounds)
+
+		stats.Rounds++
+	}
+
+	wg.Wait()
+}
+
+// runRound runs a single repetition of every cell, or InParallelCount instances without a matrix
+func (m *manager) runRound(ctx context.Context, repetition int, cells []matrixCell) {
+	queue := make(chan runSpec)
+	go func() {
+		for _, cell := range cells {
+			for c := 0; c < m.copies(); c++ {
+				queue <- runSpec{repetition: repetition, cell: cell}
+			}
+		}
+
+		close(queue)
+	}()
+
+	m.runWorkers(ctx, queue)
+}
@@ -0,0 +1,81 @@
+package bifrost
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewTrigger(t *testing.T) {
+	trigger, err := newTrigger(ManagerConfig{})
+	assert.Nil(t, err)
+	assert.Nil(t, trigger)
+
+	trigger, err = newTrigger(ManagerConfig{Schedule: ScheduleConfig{Every: "0s"}})
+	assert.Nil(t, err)
+	assert.Nil(t, trigger)
+
+	_, err = newTrigger(ManagerConfig{Schedule: ScheduleConfig{Every: "1m", Cron: "@hourly"}})
+	assert.Equal(t, "Schedule", err.(*FieldError).Field)
+
+	_, err = newTrigger(ManagerConfig{Schedule: ScheduleConfig{Cron: "61 * * * *"}})
+	assert.Equal(t, "Schedule.Cron", err.(*FieldError).Field)
+
+	_, err = newTrigger(ManagerConfig{Schedule: ScheduleConfig{Every: "1m", Overlap: "sometimes"}})
+	assert.Equal(t, "Schedule.Overlap", err.(*FieldError).Field)
+}
+
+func TestTrigger(t *testing.T) {
+	now := time.Date(2030, 1, 2, 15, 4, 30, 0, time.UTC)
+
+	trigger, err := newTrigger(ManagerConfig{Schedule: ScheduleConfig{Every: "1m"}})
+	assert.Nil(t, err)
+
+	trigger.until = time.Date(2030, 1, 2, 15, 10, 0, 0, time.UTC)
+
+	assert.Equal(t, now, trigger.first(now))
+	assert.Equal(t, now.Add(time.Minute), trigger.next(now, now.Add(time.Second)))
+
+	// rounds which are already overdue are left out
+	assert.Equal(t, now.Add(3*time.Minute), trigger.next(now, now.Add(150*time.Second)))
+
+	assert.False(t, trigger.done(now))
+	assert.True(t, trigger.done(now.Add(10*time.Minute)))
+
+	trigger, err = newTrigger(ManagerConfig{Schedule: ScheduleConfig{Cron: "*/5 * * * *"}})
+	assert.Nil(t, err)
+
+	assert.Equal(t, time.Date(2030, 1, 2, 15, 5, 0, 0, time.UTC), trigger.first(now))
+	assert.Equal(t, time.Date(2030, 1, 2, 15, 10, 0, 0, time.UTC), trigger.next(now, now.Add(time.Minute)))
+	assert.False(t, trigger.done(now.Add(time.Hour)))
+}
+
+func TestScheduleCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		summary, err := execute(ctx, "", ManagerConfig{
+			AbsolutePath:    "/bin/true",
+			Repeat:          1,
+			InParallelCount: 1,
+			Schedule:        ScheduleConfig{Every: "1h"},
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, 1, summary.schedule.Rounds)
+	}()
+
+	// the first round runs straight away, the next one is an hour away
+	time.Sleep(200 * time.Millisecond)
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the schedule kept waiting for its next round once cancelled")
+	}
+}
@@ -0,0 +1,260 @@
+// Copyright 2019 John Darrington johnw.darrington@gmail.com
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package bifrost
+
+import (
+	"encoding"
+	"reflect"
+)
+
+// schemaDescriptions documents every field of a configuration file, keyed by type and field name
+var schemaDescriptions = map[string]string{
+	"ManagerConfig.AbsolutePath":     "Path of the program to run",
+	"ManagerConfig.ProgramArguments": "Arguments passed to the program, rendered as Go templates for every run - e.g \"--port={{add 8000 .Instance}}\"",
+	"ManagerConfig.TimeoutString":    "How long a run may take before it is killed, as a Go duration - e.g \"30s\", \"5m\" or \"1h\"",
+	"ManagerConfig.Repeat":           "How many times the program is run, for every matrix cell when a matrix is set",
+	"ManagerConfig.InParallelCount":  "How many instances of the program run at the same time",
+	"ManagerConfig.Log":              "Log the program's output to LogName",
+	"ManagerConfig.LogName":          "Path of the log file",
+	"ManagerConfig.LogOverwrite":     "Overwrite the log file instead of appending to it",
+	"ManagerConfig.LogFilter":        "Regular expression, only output lines matching it are logged and displayed",
+	"ManagerConfig.Verbose":          "Display the program's output while heimdall runs",
+	"ManagerConfig.DetectDivergence": "Report how many distinct outputs were produced across runs and diff each outlier against the most common one",
+	"ManagerConfig.StdinString":      "Feed this string to the program's stdin",
+	"ManagerConfig.StdinFile":        "Feed the contents of this file to the program's stdin",
+	"ManagerConfig.StdinTemplate":    "Feed a file to the program's stdin, its path rendered for every run - e.g \"input-{{.Repetition}}.txt\"",
+	"ManagerConfig.StdinParent":      "Feed heimdall's own stdin to the program, copied to every run or split by line across instances",
+	"ManagerConfig.Env":              "Environment variables set for the program, in KEY=VALUE form",
+	"ManagerConfig.UnsetEnv":         "Names of environment variables removed from the program's environment",
+	"ManagerConfig.CleanEnv":         "Start the program with an empty environment instead of heimdall's own",
+	"ManagerConfig.WorkingDir":       "Working directory of the program, defaults to the current directory",
+	"ManagerConfig.Matrix":           "Parameter sweep, the program is run for every combination of the axes' values",
+	"ManagerConfig.ShellCommand":     "Command run through Shell instead of AbsolutePath, allowing pipelines and compound commands",
+	"ManagerConfig.Shell":            "Shell and its arguments used to run ShellCommand and hooks, defaults to \"sh -c\" or \"cmd /C\" on Windows",
+	"ManagerConfig.Hooks":            "Shell commands run before and after all runs, and before and after each run",
+	"ManagerConfig.DependsOn":        "Names of the jobs which must succeed before this job runs",
+	"ManagerConfig.ReportName":       "Path of a json report holding the summary and every run's result",
+	"ManagerConfig.MetricsAddr":      "Address Prometheus metrics are served on at /metrics while heimdall runs - e.g \":9090\"",
+	"ManagerConfig.ControlAddr":      "Address the control API is served on while heimdall runs, preferably unix: followed by a socket path - e.g \"unix:heimdall.sock\" - or a loopback host and port",
+	"ManagerConfig.Schedule":         "Run the program periodically instead of back to back",
+	"ManagerConfig.For":              "Repeat the program back to back for this long instead of Repeat times, as a Go duration - e.g \"8h\"",
+	"ManagerConfig.Until":            "Repeat the program back to back until this RFC 3339 timestamp instead of Repeat times - e.g \"2030-01-02T15:04:05Z\"",
+	"ManagerConfig.OnDeadline":       "What happens to runs still going once For or Until has passed, finish lets them finish and kill kills them",
+	"ManagerConfig.Ramp":             "Start instances gradually rather than all InParallelCount at once",
+	"ManagerConfig.Rate":             "Start this many runs per second whether or not earlier runs have finished, InParallelCount capping how many run at once",
+	"ManagerConfig.Thresholds":       "Fail runs which used more memory or CPU time than allowed",
+	"ManagerConfig.Limits":           "Constrain the resources of every run's process, Linux only",
+	"ManagerConfig.Sampling":         "Sample every running process's resources from /proc while it runs, Linux only",
+	"ManagerConfig.Watch":            "Paths heimdall watch restarts the program on changes to",
+
+	"HookConfig.BeforeAll":  "Run once before the program is first started, a failure stops heimdall",
+	"HookConfig.BeforeEach": "Run before every run, a failure fails the run without starting the program",
+	"HookConfig.AfterEach":  "Run after every run with HEIMDALL_EXIT_CODE, HEIMDALL_DURATION and HEIMDALL_LOG_PATH set",
+	"HookConfig.AfterAll":   "Run once after every run has finished with HEIMDALL_RUNS and HEIMDALL_FAILED set",
+
+	"Matrix.Axes":    "Named parameters and the values they take",
+	"Matrix.Include": "Combinations added to the matrix",
+	"Matrix.Exclude": "Combinations removed from the axes' combinations, every one matching all of an entry's values. Included combinations are kept",
+
+	"ScheduleConfig.Every":   "Run a round at this interval, as a Go duration - e.g \"5m\"",
+	"ScheduleConfig.Cron":    "Run a round whenever this standard cron expression matches - e.g \"*/5 * * * *\" or \"@hourly\"",
+	"ScheduleConfig.Overlap": "What to do when a round is due while the previous one is still running",
+	"ScheduleConfig.Count":   "Stop scheduling after this many rounds were started, 0 for no limit",
+
+	"RampConfig.Start":    "Instances started straight away, defaults to Step",
+	"RampConfig.Step":     "Instances added every Interval until InParallelCount are running",
+	"RampConfig.Interval": "How often Step instances are added, as a Go duration - e.g \"30s\"",
+	"RampConfig.Stages":   "Concurrency curve followed instead of adding Step instances, the execution lasts as long as its stages unless For or Until is set",
+	"RampConfig.Shape":    "Whether concurrency jumps to each stage's straight away (step) or moves towards it over the stage (linear)",
+
+	"RampStage.Duration":    "How long the stage lasts, as a Go duration",
+	"RampStage.Concurrency": "How many instances run at once during the stage, at most InParallelCount",
+
+	"ThresholdConfig.MaxMemory": "Most memory a run may have resident at once, in bytes or with a K, M or G suffix - e.g \"512M\", not checked on Windows. On Linux only the program's own process counts unless cgroups are used",
+	"ThresholdConfig.MaxCPU":    "Most CPU time, user and system together, a run may use as a Go duration - e.g \"30s\"",
+
+	"LimitConfig.Memory":       "Most memory a run's process may use, its address space or memory.max with Cgroup, in bytes or with a K, M or G suffix - e.g \"512M\"",
+	"LimitConfig.CPUTime":      "Most CPU time a run's process may use before it is killed, as a Go duration - e.g \"30s\"",
+	"LimitConfig.OpenFiles":    "Most files a run's process may hold open",
+	"LimitConfig.Processes":    "Most processes the run's user may run at once, or pids.max for the run alone with Cgroup",
+	"LimitConfig.Cgroup":       "Place every run in a cgroup v2 of its own where available, falling back to rlimits",
+	"LimitConfig.CgroupParent": "Delegated cgroup runs' cgroups are created below, relative to the cgroup v2 mount, defaults to heimdall's own",
+	"LimitConfig.CPUs":         "How many CPUs a run may use at once through cpu.max, requires Cgroup - e.g 0.5",
+
+	"SamplingConfig.Interval": "How often every running process and its children are sampled, as a Go duration - e.g \"500ms\"",
+	"SamplingConfig.Growth":   "Percentage a run's memory must grow by between the first and last third of its samples to be flagged, defaults to 20",
+
+	"WatchConfig.Paths":    "Files, directories or globs to watch, \"**\" matching any number of directories - e.g \"src/**/*.go\", defaults to the current directory",
+	"WatchConfig.Debounce": "How long no further change must be seen before the program is restarted, as a Go duration, defaults to 200ms",
+	"WatchConfig.Build":    "Shell command run every time before the program is started, the program isn't started when it fails",
+
+	"MatrixAxis.Name":   "Name of the parameter, available to templates as .Params.<name>",
+	"MatrixAxis.Values": "Values the parameter takes",
+}
+
+// durationPattern matches the Go durations accepted by configuration files
+const durationPattern = `^(0|([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h))+)?$`
+
+// sizePattern matches the sizes accepted by configuration files, see parseSize
+const sizePattern = `^\s*([0-9]+(\.[0-9]+)?\s*([KkMmGgTt]([Ii]?[Bb])?|[Bb])?\s*)?$`
+
+// schemaConstraints narrows the schema of fields whose values are restricted beyond their type
+var schemaConstraints = map[string]map[string]interface{}{
+	"ManagerConfig.TimeoutString":   {"pattern": durationPattern},
+	"ManagerConfig.Repeat":          {"minimum": 1},
+	"ManagerConfig.InParallelCount": {"minimum": 1},
+	"ManagerConfig.LogFilter":       {"format": "regex"},
+	"ManagerConfig.StdinParent":     {"enum": []string{"", StdinFanOut, StdinRoundRobin}},
+	"ManagerConfig.Env":             {"items": map[string]interface{}{"type": "string", "pattern": "^[^=]+="}},
+	"ManagerConfig.For":             {"pattern": durationPattern},
+	"ManagerConfig.OnDeadline":      {"enum": []string{"", DeadlineFinish, DeadlineKill}},
+	"ManagerConfig.Rate":            {"minimum": 0},
+
+	"ScheduleConfig.Every":   {"pattern": durationPattern},
+	"ScheduleConfig.Overlap": {"enum": []string{"", OverlapSkip, OverlapQueue, OverlapConcurrent, OverlapKill}},
+	"ScheduleConfig.Count":   {"minimum": 0},
+
+	"RampConfig.Start":      {"minimum": 0},
+	"RampConfig.Step":       {"minimum": 0},
+	"RampConfig.Interval":   {"pattern": durationPattern},
+	"RampConfig.Shape":      {"enum": []string{"", RampStep, RampLinear}},
+	"RampStage.Duration":    {"pattern": durationPattern},
+	"RampStage.Concurrency": {"minimum": 0},
+
+	"ThresholdConfig.MaxMemory": {"pattern": sizePattern},
+	"ThresholdConfig.MaxCPU":    {"pattern": durationPattern},
+
+	"LimitConfig.Memory":    {"pattern": sizePattern},
+	"LimitConfig.CPUTime":   {"pattern": durationPattern},
+	"LimitConfig.OpenFiles": {"minimum": 0},
+	"LimitConfig.Processes": {"minimum": 0},
+	"LimitConfig.CPUs":      {"minimum": 0},
+
+	"SamplingConfig.Interval": {"pattern": durationPattern},
+	"SamplingConfig.Growth":   {"minimum": 0},
+
+	"WatchConfig.Debounce": {"pattern": durationPattern},
+}
+
+var textMarshaler = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+// Schema returns a JSON Schema describing heimdall configuration files, either a single program configuration or
+// Defaults shared by several named Jobs. Fields only settable from code, such as Timeout, are left out in favour of
+// their configuration file counterparts.
+func Schema() map[string]interface{} {
+	// a json configuration file may name its schema for editors to find
+	reference := map[string]interface{}{"type": "string", "description": "Schema of this file, for editors"}
+
+	config := schemaObject(reflect.TypeOf(ManagerConfig{}))
+	config["properties"].(map[string]interface{})["$schema"] = reference
+
+	return map[string]interface{}{
+		"$schema":     "http://json-schema.org/draft-07/schema#",
+		"title":       "heimdall configuration",
+		"definitions": map[string]interface{}{"ManagerConfig": config},
+		"oneOf": []interface{}{
+			map[string]interface{}{"$ref": "#/definitions/ManagerConfig"},
+			map[string]interface{}{
+				"type":                 "object",
+				"additionalProperties": false,
+				"required":             []string{"Jobs"},
+				"properties": map[string]interface{}{
+					"$schema": reference,
+					"Defaults": map[string]interface{}{
+						"description": "Settings every job inherits unless it sets them itself",
+						"$ref":        "#/definitions/ManagerConfig",
+					},
+					"Jobs": map[string]interface{}{
+						"description":          "Named jobs, run by name with heimdall run <job>",
+						"type":                 "object",
+						"additionalProperties": map[string]interface{}{"$ref": "#/definitions/ManagerConfig"},
+					},
+				},
+			},
+		},
+	}
+}
+
+// schemaObject describes a struct, every field but the ones hidden from json is a property
+func schemaObject(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Tag.Get("json") == "-" || field.PkgPath != "" {
+			continue
+		}
+
+		key := t.Name() + "." + field.Name
+
+		property := schemaType(field.Type)
+		if description, ok := schemaDescriptions[key]; ok {
+			property["description"] = description
+		}
+
+		for k, v := range schemaConstraints[key] {
+			property[k] = v
+		}
+
+		properties[field.Name] = property
+	}
+
+	return map[string]interface{}{
+		"type":                 "object",
+		"additionalProperties": false,
+		"properties":           properties,
+	}
+}
+
+// schemaType describes a value of type t. Pointers, slices and maps may also be null, as json written by heimdall
+// holds null for them when unset.
+func schemaType(t reflect.Type) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Map:
+		schema := schemaValue(t)
+		schema["type"] = []interface{}{schema["type"], "null"}
+
+		return schema
+	default:
+		return schemaValue(t)
+	}
+}
+
+// schemaValue describes a non null value of type t
+func schemaValue(t reflect.Type) map[string]interface{} {
+	if t.Implements(textMarshaler) {
+		return map[string]interface{}{"type": "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return schemaValue(t.Elem())
+	case reflect.Struct:
+		return schemaObject(t)
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": schemaType(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaType(t.Elem())}
+	default:
+		return map[string]interface{}{"type": "string"}
+	}
+}
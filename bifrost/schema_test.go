@@ -0,0 +1,44 @@
+package bifrost
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchemaDescriptions(t *testing.T) {
+	for _, config := range []interface{}{ManagerConfig{}, HookConfig{}, ScheduleConfig{}, RampConfig{}, RampStage{}, ThresholdConfig{}, LimitConfig{}, SamplingConfig{}, WatchConfig{}, Matrix{}, MatrixAxis{}} {
+		typ := reflect.TypeOf(config)
+
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			if field.Tag.Get("json") == "-" {
+				continue
+			}
+
+			assert.Contains(t, schemaDescriptions, typ.Name()+"."+field.Name)
+		}
+	}
+}
+
+func TestSchema(t *testing.T) {
+	definitions := Schema()["definitions"].(map[string]interface{})
+	properties := definitions["ManagerConfig"].(map[string]interface{})["properties"].(map[string]interface{})
+
+	assert.NotContains(t, properties, "Timeout")
+	assert.Contains(t, properties, "TimeoutString")
+	assert.Equal(t, []interface{}{"object", "null"}, properties["Matrix"].(map[string]interface{})["type"])
+	assert.Equal(t, []interface{}{"string", "null"}, properties["LogFilter"].(map[string]interface{})["type"])
+
+	// the published schema must be regenerated whenever the configuration changes
+	published, err := ioutil.ReadFile("../heimdall.schema.json")
+	assert.Nil(t, err)
+
+	generated, err := json.MarshalIndent(Schema(), "", "  ")
+	assert.Nil(t, err)
+
+	assert.JSONEq(t, string(generated), string(published))
+}
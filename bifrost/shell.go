@@ -0,0 +1,98 @@
+// Copyright 2019 John Darrington johnw.darrington@gmail.com
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package bifrost
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// defaultShell is used to run ShellCommand when no Shell is configured
+func defaultShell() []string {
+	if runtime.GOOS == "windows" {
+		return []string{"cmd", "/C"}
+	}
+
+	return []string{"sh", "-c"}
+}
+
+// shellInvocation returns the configured shell split into the program and its arguments
+func shellInvocation(config ManagerConfig) []string {
+	shell := strings.Fields(config.Shell)
+	if len(shell) == 0 {
+		return defaultShell()
+	}
+
+	return shell
+}
+
+// shellName is the name a shell command's arguments are preceded by, a shell running a command taking the first
+// argument after it as the command's name - "$0" - rather than one of its arguments
+const shellName = "heimdall"
+
+// commandLine returns the program to execute and its unrendered arguments. In shell mode the program is the shell
+// and ShellCommand is handed to it followed by ProgramArguments, which cmd takes as they are and any other shell
+// after shellName.
+func commandLine(config ManagerConfig) (string, []string) {
+	if config.ShellCommand == "" {
+		return config.AbsolutePath, config.ProgramArguments
+	}
+
+	shell := shellInvocation(config)
+
+	arguments := append([]string{}, shell[1:]...)
+	arguments = append(arguments, config.ShellCommand)
+
+	if len(config.ProgramArguments) == 0 {
+		return shell[0], arguments
+	}
+
+	if name := strings.TrimSuffix(strings.ToLower(filepath.Base(shell[0])), ".exe"); name != "cmd" {
+		arguments = append(arguments, shellName)
+	}
+
+	return shell[0], append(arguments, config.ProgramArguments...)
+}
+
+// LookupExecutable resolves the executable a user asked heimdall to run to an absolute path. Paths are resolved
+// against the current directory, as are bare names when an executable by that name exists there. Any other bare name
+// is searched for in the directories named by the PATH environment variable.
+func LookupExecutable(name string) (string, error) {
+	if !strings.ContainsAny(name, `/\`) {
+		if info, err := os.Stat(name); err != nil || !isExecutable(info) {
+			path, err := exec.LookPath(name)
+			if err != nil {
+				return "", err
+			}
+
+			name = path
+		}
+	}
+
+	return filepath.Abs(name)
+}
+
+// isExecutable reports whether info describes a file the current user may execute. Windows decides by extension
+// instead, any file counts there.
+func isExecutable(info os.FileInfo) bool {
+	if info.IsDir() {
+		return false
+	}
+
+	return runtime.GOOS == "windows" || info.Mode()&0111 != 0
+}
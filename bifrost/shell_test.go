@@ -0,0 +1,73 @@
+package bifrost
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommandLine(t *testing.T) {
+	program, arguments := commandLine(ManagerConfig{AbsolutePath: "/bin/tool", ProgramArguments: []string{"a"}})
+	assert.Equal(t, "/bin/tool", program)
+	assert.Equal(t, []string{"a"}, arguments)
+
+	program, arguments = commandLine(ManagerConfig{ShellCommand: "make && ./tool", Shell: "bash -lc", ProgramArguments: []string{"a"}})
+	assert.Equal(t, "bash", program)
+	assert.Equal(t, []string{"-lc", "make && ./tool", shellName, "a"}, arguments)
+
+	program, arguments = commandLine(ManagerConfig{ShellCommand: "tool.bat", Shell: "cmd /C", ProgramArguments: []string{"a"}})
+	assert.Equal(t, "cmd", program)
+	assert.Equal(t, []string{"/C", "tool.bat", "a"}, arguments)
+}
+
+func TestShellArguments(t *testing.T) {
+	logName := filepath.Join(t.TempDir(), "heimdall.log")
+
+	_, err := execute(context.Background(), "", ManagerConfig{
+		ShellCommand:     `echo "first=$1 all=$@"`,
+		Shell:            "/bin/sh -c",
+		ProgramArguments: []string{"a", "b"},
+		Repeat:           1,
+		InParallelCount:  1,
+		Log:              true,
+		LogName:          logName,
+	})
+	assert.Nil(t, err)
+
+	content, _ := ioutil.ReadFile(logName)
+	assert.Contains(t, string(content), "first=a all=a b\n")
+}
+
+func TestLookupExecutable(t *testing.T) {
+	dir, _ := filepath.EvalSymlinks(t.TempDir())
+
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	os.Chdir(dir)
+
+	assert.Nil(t, ioutil.WriteFile("tool", []byte("#!/bin/sh\n"), 0755))
+	assert.Nil(t, ioutil.WriteFile("sh", []byte("not a program"), 0644))
+
+	path, err := LookupExecutable("tool")
+	assert.Nil(t, err)
+	assert.Equal(t, filepath.Join(dir, "tool"), path)
+
+	// a file in the current directory which can't be executed doesn't hide the program on the PATH
+	onPath, _ := exec.LookPath("sh")
+
+	path, err = LookupExecutable("sh")
+	assert.Nil(t, err)
+	assert.Equal(t, onPath, path)
+
+	path, err = LookupExecutable("./sh")
+	assert.Nil(t, err)
+	assert.Equal(t, filepath.Join(dir, "sh"), path)
+
+	_, err = LookupExecutable("heimdall-no-such-executable")
+	assert.NotNil(t, err)
+}
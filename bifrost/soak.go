@@ -0,0 +1,155 @@
+// Copyright 2019 John Darrington johnw.darrington@gmail.com
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package bifrost
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+)
+
+// Deadline policies deciding what happens to runs still going once a soak's deadline passes
+const (
+	// DeadlineFinish lets running runs finish while no new ones are started, this is the default
+	DeadlineFinish = "finish"
+	// DeadlineKill kills running runs
+	DeadlineKill = "kill"
+)
+
+// soakSummary is the throughput of a soak, it is part of the summary and report of a soak
+type soakSummary struct {
+	Runs          int
+	Seconds       float64
+	RunsPerMinute float64
+}
+
+func (s *soakSummary) String() string {
+	return fmt.Sprintf("%d runs in %s, %.2f runs per minute", s.Runs, roundDuration(s.Seconds), s.RunsPerMinute)
+}
+
+// soak holds when runs must stop for an execution bound by time rather than a count
+type soak struct {
+	length time.Duration
+	until  time.Time
+	kill   bool
+}
+
+// newSoak parses a configuration's For, Until and OnDeadline, returning nil when the execution isn't a soak
+func newSoak(config ManagerConfig) (*soak, error) {
+	s := &soak{}
+
+	if config.For != "" {
+		length, err := time.ParseDuration(config.For)
+		if err != nil {
+			return nil, &FieldError{Field: "For", Err: err}
+		}
+
+		if length < 0 {
+			return nil, &FieldError{Field: "For", Err: errors.New("must not be negative")}
+		}
+
+		s.length = length
+	}
+
+	if config.Until != "" {
+		until, err := time.Parse(time.RFC3339, config.Until)
+		if err != nil {
+			return nil, &FieldError{Field: "Until", Err: err}
+		}
+
+		s.until = until
+	}
+
+	switch config.OnDeadline {
+	case "", DeadlineFinish:
+	case DeadlineKill:
+		s.kill = true
+	default:
+		return nil, &FieldError{Field: "OnDeadline", Err: fmt.Errorf("unknown policy %q, expected %q or %q",
+			config.OnDeadline, DeadlineFinish, DeadlineKill)}
+	}
+
+	if s.length == 0 && s.until.IsZero() {
+		return nil, nil
+	}
+
+	return s, nil
+}
+
+// deadline returns when a soak starting at start must stop, the earliest of its length and until
+func (s *soak) deadline(start time.Time) time.Time {
+	if s.length == 0 {
+		return s.until
+	}
+
+	deadline := start.Add(s.length)
+	if !s.until.IsZero() && s.until.Before(deadline) {
+		return s.until
+	}
+
+	return deadline
+}
+
+// runSoak repeats every cell back to back until the deadline, returning once every run has finished. Interrupting
+// heimdall ends the soak early and lets running runs finish. Once ctx is done the soak ends as well and runs are killed.
+func (m *manager) runSoak(ctx context.Context, deadline time.Time, cells []matrixCell) {
+	stop, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+
+	go func() {
+		select {
+		case <-interrupt:
+			fmt.Fprintln(os.Stderr, "heimdall: interrupted, waiting for running runs to finish")
+			cancel()
+		case <-stop.Done():
+		}
+	}()
+
+	m.stop = stop.Done()
+
+	queue := make(chan runSpec)
+	go m.repeat(stop, queue, cells)
+
+	m.runWorkers(ctx, queue)
+}
+
+// repeat queues repetition after repetition of every cell until stop is done, closing the queue then
+func (m *manager) repeat(stop context.Context, queue chan<- runSpec, cells []matrixCell) {
+	defer close(queue)
+
+	for i := 0; ; i++ {
+		for _, cell := range cells {
+			for c := 0; c < m.copies(); c++ {
+				// checked first as select picks at random when a worker is free as well
+				if stop.Err() != nil {
+					return
+				}
+
+				select {
+				case queue <- runSpec{repetition: i, cell: cell}:
+				case <-stop.Done():
+					return
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package bifrost
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewSoak(t *testing.T) {
+	soak, err := newSoak(ManagerConfig{})
+	assert.Nil(t, err)
+	assert.Nil(t, soak)
+
+	soak, err = newSoak(ManagerConfig{For: "0s"})
+	assert.Nil(t, err)
+	assert.Nil(t, soak)
+
+	_, err = newSoak(ManagerConfig{For: "8 hours"})
+	assert.Equal(t, "For", err.(*FieldError).Field)
+
+	_, err = newSoak(ManagerConfig{Until: "tomorrow"})
+	assert.Equal(t, "Until", err.(*FieldError).Field)
+
+	_, err = newSoak(ManagerConfig{For: "8h", OnDeadline: "abandon"})
+	assert.Equal(t, "OnDeadline", err.(*FieldError).Field)
+
+	soak, err = newSoak(ManagerConfig{For: "8h", OnDeadline: DeadlineKill})
+	assert.Nil(t, err)
+	assert.True(t, soak.kill)
+}
+
+func TestSoakDeadline(t *testing.T) {
+	start := time.Date(2030, 1, 2, 15, 0, 0, 0, time.UTC)
+
+	soak, _ := newSoak(ManagerConfig{For: "8h"})
+	assert.Equal(t, start.Add(8*time.Hour), soak.deadline(start))
+
+	soak, _ = newSoak(ManagerConfig{Until: "2030-01-02T18:00:00Z"})
+	assert.Equal(t, start.Add(3*time.Hour), soak.deadline(start))
+
+	// whichever comes first
+	soak, _ = newSoak(ManagerConfig{For: "8h", Until: "2030-01-02T18:00:00Z"})
+	assert.Equal(t, start.Add(3*time.Hour), soak.deadline(start))
+
+	soak, _ = newSoak(ManagerConfig{For: "1h", Until: "2030-01-02T18:00:00Z"})
+	assert.Equal(t, start.Add(time.Hour), soak.deadline(start))
+}
+
+func TestSoakCancel(t *testing.T) {
+	for _, config := range []ManagerConfig{
+		{AbsolutePath: "/bin/sleep", ProgramArguments: []string{"0.05"}, Repeat: 1, InParallelCount: 1, For: "1h"},
+		{AbsolutePath: "/bin/true", Repeat: 1, InParallelCount: 1, For: "1h", Schedule: ScheduleConfig{Every: "1h"}},
+	} {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+
+			_, err := execute(ctx, "", config)
+			assert.Nil(t, err)
+		}()
+
+		time.Sleep(200 * time.Millisecond)
+		cancel()
+
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("the soak kept going once cancelled")
+		}
+	}
+}
@@ -0,0 +1,281 @@
+// Copyright 2019 John Darrington johnw.darrington@gmail.com
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package bifrost
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// Modes for feeding heimdall's own stdin to the managed program
+const (
+	// StdinFanOut hands every run a full copy of heimdall's stdin
+	StdinFanOut = "fanout"
+	// StdinRoundRobin splits heimdall's stdin by line, handing line n to instance n modulo the parallel count
+	StdinRoundRobin = "roundrobin"
+)
+
+// stdinSource decides what each run of the managed program receives on its stdin. Only one of its sources is ever
+// set, the zero value leaves stdin unattached.
+type stdinSource struct {
+	literal  *string
+	file     string
+	template *template.Template
+
+	// parent holds heimdall's own stdin as it is read, runs receive it while it arrives rather than once it ended.
+	// When splitting round-robin it holds the share of every instance instead.
+	parent    *stream
+	instances []*stream
+}
+
+// stdinSources counts the stdin sources a configuration sets, at most one may be set
+func stdinSources(config ManagerConfig) int {
+	set := 0
+	for _, option := range []bool{config.StdinString != "", config.StdinFile != "", config.StdinTemplate != "", config.StdinParent != ""} {
+		if option {
+			set++
+		}
+	}
+
+	return set
+}
+
+func newStdinSource(config ManagerConfig, parent io.Reader) (*stdinSource, error) {
+	if stdinSources(config) > 1 {
+		return nil, errors.New("only one of StdinString, StdinFile, StdinTemplate and StdinParent may be set")
+	}
+
+	source := &stdinSource{}
+
+	switch {
+	case config.StdinString != "":
+		source.literal = &config.StdinString
+
+	case config.StdinFile != "":
+		if _, err := os.Stat(config.StdinFile); err != nil {
+			return nil, err
+		}
+
+		source.file = config.StdinFile
+
+	case config.StdinTemplate != "":
+		t, err := parseTemplate("stdin", config.StdinTemplate)
+		if err != nil {
+			return nil, err
+		}
+
+		source.template = t
+
+	case config.StdinParent == StdinFanOut:
+		source.parent = newStream()
+
+		go source.parent.copy(parent)
+
+	case config.StdinParent == StdinRoundRobin:
+		source.instances = splitRoundRobin(parent, config.InParallelCount)
+
+	case config.StdinParent != "":
+		return nil, fmt.Errorf("unknown StdinParent mode %q, expected %q or %q", config.StdinParent, StdinFanOut, StdinRoundRobin)
+	}
+
+	return source, nil
+}
+
+// open returns the stdin for a single run. The returned closer must be called once the run has finished, it is
+// nil when nothing needs closing.
+func (s *stdinSource) open(run runInfo) (io.Reader, io.Closer, error) {
+	switch {
+	case s.literal != nil:
+		return strings.NewReader(*s.literal), nil, nil
+
+	case s.file != "":
+		f, err := os.Open(s.file)
+		return f, f, err
+
+	case s.template != nil:
+		path := &strings.Builder{}
+		if err := s.template.Execute(path, run); err != nil {
+			return nil, nil, err
+		}
+
+		f, err := os.Open(path.String())
+		return f, f, err
+
+	case s.parent != nil:
+		return s.parent.open()
+
+	// instances added by scaling up past InParallelCount have no share of the input
+	case s.instances != nil && run.Instance < len(s.instances):
+		return s.instances[run.Instance].open()
+
+	case s.instances != nil:
+		return strings.NewReader(""), nil, nil
+	}
+
+	return nil, nil, nil
+}
+
+// splitRoundRobin deals the lines of input out to count instances in turn, as they are read
+func splitRoundRobin(input io.Reader, count int) []*stream {
+	if count < 1 {
+		count = 1
+	}
+
+	instances := make([]*stream, count)
+	for i := range instances {
+		instances[i] = newStream()
+	}
+
+	go func() {
+		lines := bufio.NewReader(input)
+
+		for i := 0; ; i++ {
+			line, err := lines.ReadBytes('\n')
+			if len(line) > 0 {
+				instances[i%count].write(line)
+			}
+
+			if err != nil {
+				break
+			}
+		}
+
+		for _, instance := range instances {
+			instance.end()
+		}
+	}()
+
+	return instances
+}
+
+// stream holds input which is still being read. Everything read is kept so that runs started later, such as the
+// next repetition, receive the input from its start.
+type stream struct {
+	mu      sync.Mutex
+	changed *sync.Cond
+	data    []byte
+	ended   bool
+}
+
+func newStream() *stream {
+	s := &stream{}
+	s.changed = sync.NewCond(&s.mu)
+
+	return s
+}
+
+// copy reads input into the stream until it ends, a read error ends the input as well
+func (s *stream) copy(input io.Reader) {
+	buffer := make([]byte, 32*1024)
+
+	for {
+		n, err := input.Read(buffer)
+		if n > 0 {
+			s.write(buffer[:n])
+		}
+
+		if err != nil {
+			break
+		}
+	}
+
+	s.end()
+}
+
+func (s *stream) write(p []byte) {
+	s.mu.Lock()
+	s.data = append(s.data, p...)
+	s.mu.Unlock()
+
+	s.changed.Broadcast()
+}
+
+func (s *stream) end() {
+	s.mu.Lock()
+	s.ended = true
+	s.mu.Unlock()
+
+	s.changed.Broadcast()
+}
+
+// open returns a pipe fed with the stream from its start. Handing the program a pipe rather than a reader means
+// waiting for it doesn't also wait for input which might never arrive.
+func (s *stream) open() (io.Reader, io.Closer, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c := &streamCursor{stream: s, pipe: r, done: make(chan struct{})}
+
+	go func() {
+		io.Copy(w, c)
+		w.Close()
+		close(c.done)
+	}()
+
+	return r, c, nil
+}
+
+// streamCursor reads a stream from its start, blocking until more input arrives or the stream ends
+type streamCursor struct {
+	stream *stream
+	offset int
+	closed bool
+
+	pipe *os.File
+	done chan struct{}
+}
+
+func (c *streamCursor) Read(p []byte) (int, error) {
+	s := c.stream
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for c.offset >= len(s.data) && !s.ended && !c.closed {
+		s.changed.Wait()
+	}
+
+	if c.closed || c.offset >= len(s.data) {
+		return 0, io.EOF
+	}
+
+	n := copy(p, s.data[c.offset:])
+	c.offset += n
+
+	return n, nil
+}
+
+// Close stops feeding the pipe once the run finished, whether or not the stream ended
+func (c *streamCursor) Close() error {
+	c.stream.mu.Lock()
+	c.closed = true
+	c.stream.mu.Unlock()
+
+	c.stream.changed.Broadcast()
+
+	// unblocks a write to a program which stopped reading its stdin
+	err := c.pipe.Close()
+	<-c.done
+
+	return err
+}
@@ -0,0 +1,63 @@
+package bifrost
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStdinRoundRobin(t *testing.T) {
+	source, err := newStdinSource(ManagerConfig{StdinParent: StdinRoundRobin, InParallelCount: 2}, strings.NewReader("a\nb\nc\n"))
+	assert.Nil(t, err)
+
+	first, _, _ := source.open(runInfo{Instance: 0})
+	second, _, _ := source.open(runInfo{Instance: 1})
+
+	out, _ := ioutil.ReadAll(first)
+	assert.Equal(t, "a\nc\n", string(out))
+
+	out, _ = ioutil.ReadAll(second)
+	assert.Equal(t, "b\n", string(out))
+}
+
+func TestStdinStreams(t *testing.T) {
+	parent, input := io.Pipe()
+	defer input.Close()
+
+	source, err := newStdinSource(ManagerConfig{StdinParent: StdinFanOut}, parent)
+	assert.Nil(t, err)
+
+	// the first line reaches the run while heimdall's stdin is still open
+	go input.Write([]byte("a\n"))
+
+	stdin, closer, err := source.open(runInfo{})
+	assert.Nil(t, err)
+
+	line, err := bufio.NewReader(stdin).ReadString('\n')
+	assert.Nil(t, err)
+	assert.Equal(t, "a\n", line)
+
+	// a run finishing before the input ended doesn't wait for it
+	assert.Nil(t, closer.Close())
+}
+
+func TestStdinTemplate(t *testing.T) {
+	source, err := newStdinSource(ManagerConfig{StdinTemplate: "stdin_test.go{{if .Repetition}}.missing{{end}}"}, nil)
+	assert.Nil(t, err)
+
+	_, closer, err := source.open(runInfo{Repetition: 0})
+	assert.Nil(t, err)
+	closer.Close()
+
+	_, _, err = source.open(runInfo{Repetition: 1})
+	assert.NotNil(t, err)
+}
+
+func TestStdinSingleSource(t *testing.T) {
+	_, err := newStdinSource(ManagerConfig{StdinString: "a", StdinParent: StdinFanOut}, nil)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,413 @@
+// Copyright 2019 John Darrington johnw.darrington@gmail.com
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package bifrost
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// runResult is the outcome of a single run. Its exported fields make up the runs in heimdall's report.
+type runResult struct {
+	runInfo
+
+	Started         time.Time
+	DurationSeconds float64
+	ExitCode        int
+	TimedOut        bool
+	Killed          bool   `json:",omitempty"`
+	Error           string `json:",omitempty"`
+
+	// Usage is only missing for runs which never started, OverThreshold tells which ThresholdConfig the run exceeded
+	// and Limit which LimitConfig the run was stopped by
+	Usage         *usage `json:",omitempty"`
+	OverThreshold string `json:",omitempty"`
+	Limit         string `json:",omitempty"`
+
+	// Samples are only taken when Sampling is configured, MemoryGrowth flags a run whose memory grew across them
+	Samples      []sample `json:",omitempty"`
+	MemoryGrowth string   `json:",omitempty"`
+
+	duration time.Duration
+
+	// restart is set when the control API killed the run to start it again
+	restart bool
+}
+
+// Succeeded reports whether the run started, exited cleanly, wasn't killed by heimdall and stayed within its
+// thresholds and limits
+func (r runResult) Succeeded() bool {
+	return r.Error == "" && r.ExitCode == 0 && !r.TimedOut && !r.Killed && r.OverThreshold == "" && r.Limit == ""
+}
+
+// outcome names the reason a run failed, or that it succeeded, as a single word
+func (r runResult) outcome() string {
+	switch {
+	case r.Error != "":
+		return "error"
+	case r.TimedOut:
+		return "timed_out"
+	case r.Killed:
+		return "killed"
+	case r.Limit != "":
+		return "over_limit"
+	case r.OverThreshold != "":
+		return "over_threshold"
+	case r.ExitCode != 0:
+		return "failed"
+	default:
+		return "succeeded"
+	}
+}
+
+// cellSummary aggregates the results of every run belonging to the same matrix cell. Without a matrix every run
+// belongs to a single unnamed cell.
+type cellSummary struct {
+	Cell        string `json:",omitempty"`
+	Concurrency int    `json:",omitempty"`
+	Runs        int
+	Succeeded   int
+	Failed      int
+	TimedOut    int
+	Killed      int `json:",omitempty"`
+
+	OverThreshold int `json:",omitempty"`
+	OverLimit     int `json:",omitempty"`
+
+	MinSeconds float64
+	AvgSeconds float64
+	MaxSeconds float64
+
+	AvgCPUSeconds float64 `json:",omitempty"`
+	MaxCPUSeconds float64 `json:",omitempty"`
+	MaxRSSBytes   int64   `json:",omitempty"`
+
+	// MemoryGrowing counts the runs flagged for growing memory, which doesn't fail them
+	MemoryGrowing int `json:",omitempty"`
+
+	measured int
+	total    time.Duration
+	min      time.Duration
+	max      time.Duration
+
+	used     int
+	totalCPU time.Duration
+	maxCPU   time.Duration
+}
+
+func (c *cellSummary) add(result runResult) {
+	c.Runs++
+
+	if result.Succeeded() {
+		c.Succeeded++
+	} else {
+		c.Failed++
+	}
+
+	if result.TimedOut {
+		c.TimedOut++
+	}
+
+	if result.Killed {
+		c.Killed++
+	}
+
+	if result.OverThreshold != "" {
+		c.OverThreshold++
+	}
+
+	if result.Limit != "" {
+		c.OverLimit++
+	}
+
+	if result.MemoryGrowth != "" {
+		c.MemoryGrowing++
+	}
+
+	if result.Usage != nil {
+		c.addUsage(result.Usage)
+	}
+
+	if result.Error != "" {
+		return
+	}
+
+	c.measured++
+
+	if c.measured == 1 || result.duration < c.min {
+		c.min = result.duration
+	}
+
+	if result.duration > c.max {
+		c.max = result.duration
+	}
+
+	c.total += result.duration
+
+	c.MinSeconds = c.min.Seconds()
+	c.MaxSeconds = c.max.Seconds()
+	c.AvgSeconds = (c.total / time.Duration(c.measured)).Seconds()
+}
+
+func (c *cellSummary) addUsage(u *usage) {
+	c.used++
+
+	cpu := u.cpu()
+	c.totalCPU += cpu
+
+	if cpu > c.maxCPU {
+		c.maxCPU = cpu
+	}
+
+	if u.MaxRSSBytes > c.MaxRSSBytes {
+		c.MaxRSSBytes = u.MaxRSSBytes
+	}
+
+	c.AvgCPUSeconds = (c.totalCPU / time.Duration(c.used)).Seconds()
+	c.MaxCPUSeconds = c.maxCPU.Seconds()
+}
+
+func (c *cellSummary) String() string {
+	failures := ""
+	if c.Killed > 0 {
+		failures = fmt.Sprintf(", %d killed", c.Killed)
+	}
+
+	if c.OverThreshold > 0 {
+		failures += fmt.Sprintf(", %d over threshold", c.OverThreshold)
+	}
+
+	if c.OverLimit > 0 {
+		failures += fmt.Sprintf(", %d over limit", c.OverLimit)
+	}
+
+	out := fmt.Sprintf("%d runs, %d succeeded, %d failed (%d timed out%s) - min %s avg %s max %s",
+		c.Runs, c.Succeeded, c.Failed, c.TimedOut, failures,
+		roundDuration(c.MinSeconds), roundDuration(c.AvgSeconds), roundDuration(c.MaxSeconds))
+
+	if c.used > 0 {
+		out += fmt.Sprintf(" - cpu avg %s max %s", roundDuration(c.AvgCPUSeconds), roundDuration(c.MaxCPUSeconds))
+	}
+
+	if c.MaxRSSBytes > 0 {
+		out += fmt.Sprintf(", max rss %s", formatSize(c.MaxRSSBytes))
+	}
+
+	if c.MemoryGrowing > 0 {
+		out += fmt.Sprintf(" - %d with growing memory", c.MemoryGrowing)
+	}
+
+	return out
+}
+
+func roundDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second)).Round(time.Millisecond)
+}
+
+// summary collects the result of every run in an execution
+type summary struct {
+	lock sync.Mutex
+
+	started time.Time
+
+	// results holds every run's result for the report, it is only kept when a report is written so long executions
+	// don't grow without bound
+	results     []runResult
+	keepResults bool
+
+	total     cellSummary
+	cells     map[string]*cellSummary
+	cellOrder []string
+
+	// schedule is only set when runs were triggered by a schedule, soak when the execution was bound by time
+	schedule *scheduleSummary
+	soak     *soakSummary
+
+	// rate is only set when runs were started at a target rate
+	rate *rateSummary
+
+	// levels aggregates runs by the concurrency a ramp allowed when they started, it is nil without a ramp
+	levels map[int]*cellSummary
+}
+
+func newSummary(cells []matrixCell, keepResults bool) *summary {
+	s := &summary{started: time.Now(), cells: map[string]*cellSummary{}, keepResults: keepResults}
+
+	for _, cell := range cells {
+		if cell.Name == "" {
+			continue
+		}
+
+		s.cells[cell.Name] = &cellSummary{Cell: cell.Name}
+		s.cellOrder = append(s.cellOrder, cell.Name)
+	}
+
+	return s
+}
+
+func (s *summary) record(result runResult) {
+	result.DurationSeconds = result.duration.Seconds()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.keepResults {
+		s.results = append(s.results, result)
+	}
+
+	s.total.add(result)
+
+	if cell, ok := s.cells[result.Cell]; ok {
+		cell.add(result)
+	}
+
+	if s.levels != nil {
+		level, ok := s.levels[result.Concurrency]
+		if !ok {
+			level = &cellSummary{Concurrency: result.Concurrency}
+			s.levels[result.Concurrency] = level
+		}
+
+		level.add(result)
+	}
+}
+
+// concurrencyLevels returns the summary of every concurrency level runs started at, lowest first
+func (s *summary) concurrencyLevels() []*cellSummary {
+	var levels []*cellSummary
+	for _, level := range s.levels {
+		levels = append(levels, level)
+	}
+
+	sort.Slice(levels, func(i, j int) bool { return levels[i].Concurrency < levels[j].Concurrency })
+
+	return levels
+}
+
+// failed reports whether any run failed
+func (s *summary) failed() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.total.Failed > 0
+}
+
+// print writes the outcome of the execution, broken down by matrix cell when a matrix was used. The job's name is
+// included when not empty.
+func (s *summary) print(w io.Writer, job string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if job != "" {
+		fmt.Fprintf(w, "heimdall: job %s: %s\n", job, &s.total)
+	} else {
+		fmt.Fprintf(w, "heimdall: %s\n", &s.total)
+	}
+
+	for _, name := range s.cellOrder {
+		fmt.Fprintf(w, "  [%s] %s\n", name, s.cells[name])
+	}
+
+	for _, level := range s.concurrencyLevels() {
+		fmt.Fprintf(w, "  [concurrency %d] %s\n", level.Concurrency, level)
+	}
+
+	if s.rate != nil {
+		fmt.Fprintf(w, "  rate: %s\n", s.rate)
+	}
+
+	if s.schedule != nil {
+		fmt.Fprintf(w, "  schedule: %s\n", s.schedule)
+	}
+
+	if s.soak != nil {
+		fmt.Fprintf(w, "  soak: %s\n", s.soak)
+	}
+}
+
+// recordArrivals adds the arrivals of runs started at a rate over elapsed to the rate's summary
+func (s *summary) recordArrivals(arrivals, missed int, elapsed time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.rate.Arrivals += arrivals
+	s.rate.Missed += missed
+	s.rate.started += arrivals - missed
+	s.rate.elapsed += elapsed
+
+	s.rate.Achieved = float64(s.rate.started) / s.rate.elapsed.Seconds()
+}
+
+// finishSoak computes the throughput of a soak from every run recorded since the summary was started
+func (s *summary) finishSoak() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	elapsed := time.Since(s.started)
+	s.soak = &soakSummary{Runs: s.total.Runs, Seconds: elapsed.Seconds()}
+
+	if elapsed > 0 {
+		s.soak.RunsPerMinute = float64(s.total.Runs) / elapsed.Minutes()
+	}
+}
+
+// report is the structure of the json report written at the end of an execution
+type report struct {
+	Started  time.Time
+	Finished time.Time
+
+	Summary     *cellSummary
+	Cells       []*cellSummary   `json:",omitempty"`
+	Concurrency []*cellSummary   `json:",omitempty"`
+	Rate        *rateSummary     `json:",omitempty"`
+	Schedule    *scheduleSummary `json:",omitempty"`
+	Soak        *soakSummary     `json:",omitempty"`
+	Runs        []runResult
+}
+
+// writeReport writes every run's result along with the summary to path as json
+func (s *summary) writeReport(path string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	r := report{Started: s.started, Finished: time.Now(), Summary: &s.total, Concurrency: s.concurrencyLevels(),
+		Rate: s.rate, Schedule: s.schedule, Soak: s.soak, Runs: s.results}
+	for _, name := range s.cellOrder {
+		r.Cells = append(r.Cells, s.cells[name])
+	}
+
+	out, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, out, 0644)
+}
+
+// checkReportPath makes sure the report can be written before any time is spent running the program
+func checkReportPath(path string) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	return f.Close()
+}
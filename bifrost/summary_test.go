@@ -0,0 +1,29 @@
+package bifrost
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSummaryResults(t *testing.T) {
+	// without a report only the aggregates are kept
+	s := newSummary(nil, false)
+	for i := 0; i < 3; i++ {
+		s.record(runResult{duration: time.Second})
+	}
+
+	assert.Empty(t, s.results)
+	assert.Equal(t, 3, s.total.Runs)
+	assert.Equal(t, 3, s.total.Succeeded)
+
+	s = newSummary(nil, true)
+	s.record(runResult{ExitCode: 1, duration: time.Second})
+
+	if assert.Len(t, s.results, 1) {
+		assert.Equal(t, 1.0, s.results[0].DurationSeconds)
+	}
+
+	assert.Equal(t, 1, s.total.Failed)
+}
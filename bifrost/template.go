@@ -0,0 +1,77 @@
+// Copyright 2019 John Darrington johnw.darrington@gmail.com
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package bifrost
+
+import (
+	"strings"
+	"text/template"
+)
+
+// templateFuncs are available to every template rendered per run, letting arguments such as
+// "--port={{add 8000 .Instance}}" differ between parallel instances.
+var templateFuncs = template.FuncMap{
+	"add": func(a, b int) int { return a + b },
+	"sub": func(a, b int) int { return a - b },
+	"mul": func(a, b int) int { return a * b },
+	"mod": func(a, b int) int { return a % b },
+}
+
+// parseTemplate parses text rendered per run. Templates are handed a runInfo, referencing anything it doesn't
+// provide is an error.
+func parseTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+}
+
+// argumentTemplates parses the program arguments. Arguments which don't contain a template action are left as they
+// are and have no entry in the returned slice.
+func argumentTemplates(arguments []string) ([]*template.Template, error) {
+	templates := make([]*template.Template, len(arguments))
+
+	for i, argument := range arguments {
+		if !strings.Contains(argument, "{{") {
+			continue
+		}
+
+		t, err := parseTemplate("argument", argument)
+		if err != nil {
+			return nil, err
+		}
+
+		templates[i] = t
+	}
+
+	return templates, nil
+}
+
+// renderArguments returns the program arguments for a single run
+func renderArguments(arguments []string, templates []*template.Template, run runInfo) ([]string, error) {
+	rendered := make([]string, len(arguments))
+
+	for i, argument := range arguments {
+		if templates[i] == nil {
+			rendered[i] = argument
+			continue
+		}
+
+		out := &strings.Builder{}
+		if err := templates[i].Execute(out, run); err != nil {
+			return nil, err
+		}
+
+		rendered[i] = out.String()
+	}
+
+	return rendered, nil
+}
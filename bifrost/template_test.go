@@ -0,0 +1,21 @@
+package bifrost
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderArguments(t *testing.T) {
+	arguments := []string{"--port={{add 8000 .Instance}}", "--out=run-{{.Repetition}}-{{.RunID}}.csv", "plain"}
+
+	templates, err := argumentTemplates(arguments)
+	assert.Nil(t, err)
+
+	rendered, err := renderArguments(arguments, templates, runInfo{Instance: 2, Repetition: 1, RunID: 7})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"--port=8002", "--out=run-1-7.csv", "plain"}, rendered)
+
+	_, err = argumentTemplates([]string{"{{add 1"})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,165 @@
+// Copyright 2019 John Darrington johnw.darrington@gmail.com
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package bifrost
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ThresholdConfig fails runs which used more resources than allowed, even when the program exited cleanly. MaxMemory
+// is the most memory a run may have resident at once, in bytes or with a K, M or G suffix counting in powers of 1024
+// - e.g "512M". It is only checked where the platform reports peak memory, which Windows doesn't. On Linux it is the
+// peak of the program's own process read while it runs, or the peak of the run's cgroup, counting every process of the
+// run, when cgroups are used. MaxCPU is the most CPU time, user and system together, a run may use as a Go duration -
+// e.g "30s".
+type ThresholdConfig struct {
+	MaxMemory string
+	MaxCPU    string
+}
+
+// usage is the resources a single run's process consumed. Beyond CPU time the platform may not report every field,
+// in which case it is left zero.
+type usage struct {
+	UserSeconds   float64
+	SystemSeconds float64
+
+	MaxRSSBytes         int64 `json:",omitempty"`
+	MinorFaults         int64 `json:",omitempty"`
+	MajorFaults         int64 `json:",omitempty"`
+	VoluntarySwitches   int64 `json:",omitempty"`
+	InvoluntarySwitches int64 `json:",omitempty"`
+}
+
+// newUsage reads the usage of an exited process. Peak is the run's peak memory where it was followed while the run
+// lasted, it takes precedence over what the platform reports when not zero.
+func newUsage(state *os.ProcessState, peak int64) *usage {
+	u := &usage{UserSeconds: state.UserTime().Seconds(), SystemSeconds: state.SystemTime().Seconds()}
+	systemUsage(state, u)
+
+	if peak > 0 {
+		u.MaxRSSBytes = peak
+	}
+
+	return u
+}
+
+// cpu is the CPU time used, user and system together
+func (u *usage) cpu() time.Duration {
+	return time.Duration((u.UserSeconds + u.SystemSeconds) * float64(time.Second))
+}
+
+func (u *usage) String() string {
+	out := fmt.Sprintf("cpu %s user %s system", roundDuration(u.UserSeconds), roundDuration(u.SystemSeconds))
+
+	if peakMemorySupported {
+		out += fmt.Sprintf(", max rss %s, %d minor %d major page faults, %d voluntary %d involuntary context switches",
+			formatSize(u.MaxRSSBytes), u.MinorFaults, u.MajorFaults, u.VoluntarySwitches, u.InvoluntarySwitches)
+	}
+
+	return out
+}
+
+// thresholds holds a configuration's parsed ThresholdConfig, a zero field isn't checked
+type thresholds struct {
+	memory int64
+	cpu    time.Duration
+}
+
+func newThresholds(config ManagerConfig) (*thresholds, error) {
+	t := &thresholds{}
+
+	if config.Thresholds.MaxMemory != "" {
+		memory, err := parseSize(config.Thresholds.MaxMemory)
+		if err != nil {
+			return nil, &FieldError{Field: "Thresholds.MaxMemory", Err: err}
+		}
+
+		t.memory = memory
+	}
+
+	if config.Thresholds.MaxCPU != "" {
+		cpu, err := time.ParseDuration(config.Thresholds.MaxCPU)
+		if err != nil {
+			return nil, &FieldError{Field: "Thresholds.MaxCPU", Err: err}
+		}
+
+		if cpu < 0 {
+			return nil, &FieldError{Field: "Thresholds.MaxCPU", Err: errors.New("must not be negative")}
+		}
+
+		t.cpu = cpu
+	}
+
+	return t, nil
+}
+
+// check returns why a run using u exceeded the thresholds, empty when it didn't
+func (t *thresholds) check(u *usage) string {
+	var exceeded []string
+
+	if t.memory > 0 && u.MaxRSSBytes > t.memory {
+		exceeded = append(exceeded, fmt.Sprintf("max rss %s exceeds %s", formatSize(u.MaxRSSBytes), formatSize(t.memory)))
+	}
+
+	if t.cpu > 0 && u.cpu() > t.cpu {
+		exceeded = append(exceeded, fmt.Sprintf("cpu %s exceeds %s", u.cpu().Round(time.Millisecond), t.cpu))
+	}
+
+	return strings.Join(exceeded, ", ")
+}
+
+// sizeUnits are the suffixes a size may have, counting in powers of 1024
+var sizeUnits = []struct {
+	suffix string
+	bytes  int64
+}{
+	{"T", 1 << 40}, {"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10}, {"", 1},
+}
+
+// parseSize parses an amount of bytes such as "512M", "1.5GiB" or "4096"
+func parseSize(size string) (int64, error) {
+	trimmed := strings.TrimSuffix(strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(size)), "B"), "I")
+
+	for _, unit := range sizeUnits {
+		if !strings.HasSuffix(trimmed, unit.suffix) {
+			continue
+		}
+
+		value, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(trimmed, unit.suffix)), 64)
+		if err != nil || value < 0 {
+			break
+		}
+
+		return int64(value * float64(unit.bytes)), nil
+	}
+
+	return 0, fmt.Errorf("invalid size %q, expected bytes or a K, M or G suffix - e.g 512M", size)
+}
+
+// formatSize formats an amount of bytes in the largest unit it reaches
+func formatSize(bytes int64) string {
+	for _, unit := range sizeUnits {
+		if bytes >= unit.bytes && unit.suffix != "" {
+			return fmt.Sprintf("%.1f %siB", float64(bytes)/float64(unit.bytes), unit.suffix)
+		}
+	}
+
+	return fmt.Sprintf("%d B", bytes)
+}
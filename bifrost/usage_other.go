@@ -0,0 +1,25 @@
+// Copyright 2019 John Darrington johnw.darrington@gmail.com
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+
+package bifrost
+
+import "os"
+
+// peakMemorySupported reports whether the platform reports a run's peak memory, page faults and context switches
+const peakMemorySupported = false
+
+// systemUsage leaves the usage only reported through rusage zero, the platform having none
+func systemUsage(state *os.ProcessState, u *usage) {}
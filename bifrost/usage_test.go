@@ -0,0 +1,102 @@
+package bifrost
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSize(t *testing.T) {
+	for size, bytes := range map[string]int64{
+		"4096":   4096,
+		"512M":   512 << 20,
+		"512mb":  512 << 20,
+		"1.5GiB": 3 << 29,
+		"64 K":   64 << 10,
+		"10B":    10,
+	} {
+		parsed, err := parseSize(size)
+		assert.Nil(t, err, size)
+		assert.Equal(t, bytes, parsed, size)
+	}
+
+	for _, size := range []string{"", "M", "lots", "-1G", "12X"} {
+		_, err := parseSize(size)
+		assert.NotNil(t, err, size)
+	}
+
+	assert.Equal(t, "512.0 MiB", formatSize(512<<20))
+	assert.Equal(t, "10 B", formatSize(10))
+}
+
+func TestThresholds(t *testing.T) {
+	_, err := newThresholds(ManagerConfig{Thresholds: ThresholdConfig{MaxMemory: "lots"}})
+	assert.Equal(t, "Thresholds.MaxMemory", err.(*FieldError).Field)
+
+	_, err = newThresholds(ManagerConfig{Thresholds: ThresholdConfig{MaxCPU: "a while"}})
+	assert.Equal(t, "Thresholds.MaxCPU", err.(*FieldError).Field)
+
+	thresholds, err := newThresholds(ManagerConfig{Thresholds: ThresholdConfig{MaxMemory: "1M", MaxCPU: "1s"}})
+	assert.Nil(t, err)
+
+	assert.Equal(t, "", thresholds.check(&usage{UserSeconds: 0.5, MaxRSSBytes: 1 << 10}))
+	assert.Equal(t, "max rss 2.0 MiB exceeds 1.0 MiB, cpu 1.5s exceeds 1s",
+		thresholds.check(&usage{UserSeconds: 1, SystemSeconds: 0.5, MaxRSSBytes: 2 << 20}))
+}
+
+func TestUsage(t *testing.T) {
+	summary, err := execute(context.Background(), "", ManagerConfig{
+		AbsolutePath:     "/bin/sh",
+		ProgramArguments: []string{"-c", "i=0; while [ $i -lt 100000 ]; do i=$((i+1)); done"},
+		Repeat:           1,
+		InParallelCount:  1,
+		Thresholds:       ThresholdConfig{MaxCPU: "1ms"},
+		ReportName:       filepath.Join(t.TempDir(), "report.json"),
+	})
+	assert.Nil(t, err)
+
+	result := summary.results[0]
+	assert.NotNil(t, result.Usage)
+	assert.True(t, result.Usage.UserSeconds+result.Usage.SystemSeconds > 0)
+	assert.Contains(t, result.OverThreshold, "exceeds 1ms")
+	assert.True(t, summary.failed())
+}
+
+func TestUsageMemory(t *testing.T) {
+	// the program's peak memory doesn't include heimdall's, which it was started from
+	summary, err := execute(context.Background(), "", ManagerConfig{
+		AbsolutePath:    "/bin/true",
+		Repeat:          1,
+		InParallelCount: 1,
+		Thresholds:      ThresholdConfig{MaxMemory: "5M"},
+		ReportName:      filepath.Join(t.TempDir(), "report.json"),
+	})
+	assert.Nil(t, err)
+
+	assert.Equal(t, "", summary.results[0].OverThreshold)
+	assert.False(t, summary.failed())
+}
+
+func TestUsageLogFilter(t *testing.T) {
+	logName := filepath.Join(t.TempDir(), "heimdall.log")
+
+	_, err := execute(context.Background(), "", ManagerConfig{
+		AbsolutePath:     "/bin/echo",
+		ProgramArguments: []string{"found"},
+		Repeat:           1,
+		InParallelCount:  1,
+		Log:              true,
+		LogName:          logName,
+		LogFilter:        regexp.MustCompile("found"),
+	})
+	assert.Nil(t, err)
+
+	// the usage line is filtered out of the log like any other line not matching
+	content, _ := ioutil.ReadFile(logName)
+	assert.Contains(t, string(content), "found\n")
+	assert.NotContains(t, string(content), "exit code")
+}
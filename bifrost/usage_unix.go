@@ -0,0 +1,49 @@
+// Copyright 2019 John Darrington johnw.darrington@gmail.com
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package bifrost
+
+import (
+	"os"
+	"runtime"
+	"syscall"
+)
+
+// peakMemorySupported reports whether the platform reports a run's peak memory, page faults and context switches
+const peakMemorySupported = true
+
+// systemUsage fills in the usage only reported through the platform's rusage
+func systemUsage(state *os.ProcessState, u *usage) {
+	rusage, ok := state.SysUsage().(*syscall.Rusage)
+	if !ok {
+		return
+	}
+
+	// macOS reports the peak resident set in bytes rather than kilobytes. Linux counts heimdall's own memory in it, so
+	// the peak is followed while the run lasts instead, see peakMemory.
+	switch runtime.GOOS {
+	case "darwin":
+		u.MaxRSSBytes = int64(rusage.Maxrss)
+	case "linux":
+	default:
+		u.MaxRSSBytes = int64(rusage.Maxrss) * 1024
+	}
+
+	u.MinorFaults = int64(rusage.Minflt)
+	u.MajorFaults = int64(rusage.Majflt)
+	u.VoluntarySwitches = int64(rusage.Nvcsw)
+	u.InvoluntarySwitches = int64(rusage.Nivcsw)
+}
@@ -0,0 +1,367 @@
+// Copyright 2019 John Darrington johnw.darrington@gmail.com
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package bifrost
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// FieldError is a problem with a single field of a configuration. Field is the path to the field, e.g
+// "Hooks.BeforeEach" or "Jobs.soak.Repeat" for a field of a named job.
+type FieldError struct {
+	Field string
+	Err   error
+}
+
+func (e *FieldError) Error() string {
+	return e.Field + ": " + e.Err.Error()
+}
+
+// ConfigErrors holds every problem found with a configuration, see ManagerConfig.Validate and ValidateJobs
+type ConfigErrors []*FieldError
+
+func (errs ConfigErrors) Error() string {
+	lines := make([]string, len(errs))
+	for i, err := range errs {
+		lines[i] = err.Error()
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// Validate checks a configuration without running anything - the program exists and is executable, durations parse,
+// templates and the matrix are well formed, counts are positive and the log and report paths are writable. Every
+// problem found is returned as part of a ConfigErrors.
+func (config ManagerConfig) Validate() error {
+	var errs ConfigErrors
+
+	add := func(field string, err error) {
+		if err != nil {
+			errs = append(errs, &FieldError{Field: field, Err: err})
+		}
+	}
+
+	switch {
+	case config.ShellCommand != "":
+		_, err := exec.LookPath(shellInvocation(config)[0])
+		add("Shell", err)
+	case config.AbsolutePath == "":
+		add("AbsolutePath", errors.New("no program to run"))
+	default:
+		add("AbsolutePath", checkExecutable(config.AbsolutePath))
+	}
+
+	_, err := argumentTemplates(config.ProgramArguments)
+	add("ProgramArguments", err)
+
+	if config.TimeoutString != "" {
+		_, err := time.ParseDuration(config.TimeoutString)
+		add("TimeoutString", err)
+	}
+
+	if config.Timeout < 0 {
+		add("Timeout", errors.New("must not be negative"))
+	}
+
+	if config.Repeat < 1 {
+		add("Repeat", errors.New("must be at least 1"))
+	}
+
+	if config.InParallelCount < 1 {
+		add("InParallelCount", errors.New("must be at least 1"))
+	}
+
+	if config.Log {
+		add("LogName", checkWritable(config.LogName))
+	}
+
+	if stdinSources(config) > 1 {
+		add("Stdin", errors.New("only one of StdinString, StdinFile, StdinTemplate and StdinParent may be set"))
+	}
+
+	if config.StdinFile != "" {
+		_, err := os.Stat(config.StdinFile)
+		add("StdinFile", err)
+	}
+
+	if config.StdinTemplate != "" {
+		_, err := parseTemplate("stdin", config.StdinTemplate)
+		add("StdinTemplate", err)
+	}
+
+	if config.StdinParent != "" && config.StdinParent != StdinFanOut && config.StdinParent != StdinRoundRobin {
+		add("StdinParent", fmt.Errorf("unknown mode %q, expected %q or %q", config.StdinParent, StdinFanOut, StdinRoundRobin))
+	}
+
+	add("Env", ValidateEnv(config.Env))
+
+	if config.WorkingDir != "" {
+		if info, err := os.Stat(config.WorkingDir); err != nil {
+			add("WorkingDir", err)
+		} else if !info.IsDir() {
+			add("WorkingDir", errors.New("not a directory"))
+		}
+	}
+
+	add("Matrix", config.Matrix.validate())
+
+	if config.Hooks.BeforeEach != "" {
+		_, err := parseTemplate("beforeEach", config.Hooks.BeforeEach)
+		add("Hooks.BeforeEach", err)
+	}
+
+	if config.Hooks.AfterEach != "" {
+		_, err := parseTemplate("afterEach", config.Hooks.AfterEach)
+		add("Hooks.AfterEach", err)
+	}
+
+	if config.ReportName != "" {
+		add("ReportName", checkWritable(config.ReportName))
+	}
+
+	if config.MetricsAddr != "" {
+		_, _, err := net.SplitHostPort(config.MetricsAddr)
+		add("MetricsAddr", err)
+	}
+
+	switch {
+	case config.ControlAddr == unixPrefix:
+		add("ControlAddr", errors.New("no socket path after unix:"))
+	case config.ControlAddr != "" && !strings.HasPrefix(config.ControlAddr, unixPrefix):
+		_, err := loopbackAddr(config.ControlAddr)
+		add("ControlAddr", err)
+	}
+
+	if _, err := newTrigger(config); err != nil {
+		errs = append(errs, err.(*FieldError))
+	}
+
+	if _, err := newSoak(config); err != nil {
+		errs = append(errs, err.(*FieldError))
+	}
+
+	if _, err := newRamp(config); err != nil {
+		errs = append(errs, err.(*FieldError))
+	}
+
+	if _, err := rateInterval(config); err != nil {
+		errs = append(errs, err.(*FieldError))
+	}
+
+	if _, err := newThresholds(config); err != nil {
+		errs = append(errs, err.(*FieldError))
+	}
+
+	if _, err := newLimits(config); err != nil {
+		errs = append(errs, err.(*FieldError))
+	}
+
+	if _, err := newSampling(config); err != nil {
+		errs = append(errs, err.(*FieldError))
+	}
+
+	if config.Watch.Debounce != "" {
+		_, err := time.ParseDuration(config.Watch.Debounce)
+		add("Watch.Debounce", err)
+	}
+
+	for _, path := range config.Watch.Paths {
+		_, err := newWatchPattern(path)
+		add("Watch.Paths", err)
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return errs
+}
+
+// ValidateJobs validates every job of a configuration file and the dependencies between them. Problems with a named
+// job are reported with their field path under Jobs.<name>.
+func ValidateJobs(jobs []Job) error {
+	var errs ConfigErrors
+
+	names := make(map[string]bool, len(jobs))
+	for _, job := range jobs {
+		names[strings.ToLower(job.Name)] = true
+	}
+
+	unknown := false
+	stdinJob := ""
+
+	for _, job := range jobs {
+		prefix := jobPrefix(jobs, job)
+
+		if err, ok := job.Config.Validate().(ConfigErrors); ok {
+			for _, fieldErr := range err {
+				errs = append(errs, &FieldError{Field: prefix + fieldErr.Field, Err: fieldErr.Err})
+			}
+		}
+
+		for _, dependency := range job.Config.DependsOn {
+			if !names[strings.ToLower(dependency)] {
+				errs = append(errs, &FieldError{Field: prefix + "DependsOn", Err: fmt.Errorf("unknown job %q", dependency)})
+				unknown = true
+			}
+		}
+
+		// heimdall's stdin can only be read once
+		if job.Config.StdinParent != "" {
+			if stdinJob != "" {
+				errs = append(errs, &FieldError{Field: prefix + "StdinParent", Err: fmt.Errorf("job %q already reads heimdall's stdin", stdinJob)})
+			} else {
+				stdinJob = job.Name
+			}
+		}
+	}
+
+	// with every dependency known, only cycles are left to check for
+	if !unknown {
+		if err := checkDependencies(jobs); err != nil {
+			errs = append(errs, &FieldError{Field: "Jobs", Err: err})
+		} else {
+			errs = append(errs, checkSharedLogs(jobs)...)
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return errs
+}
+
+// jobPrefix is prepended to the fields of a job's problems, a single program file's fields are reported as they are
+func jobPrefix(jobs []Job, job Job) string {
+	if len(jobs) > 1 || job.Name != DefaultJob {
+		return "Jobs." + job.Name + "."
+	}
+
+	return ""
+}
+
+// checkSharedLogs makes sure jobs which may run at the same time don't share a log one of them overwrites. Jobs run
+// one after the other when one depends on the other, even indirectly, so dependencies must not form a cycle.
+func checkSharedLogs(jobs []Job) ConfigErrors {
+	byName := make(map[string]Job, len(jobs))
+	for _, job := range jobs {
+		byName[strings.ToLower(job.Name)] = job
+	}
+
+	// after holds every job a job runs after
+	after := map[string]map[string]bool{}
+
+	var dependencies func(name string) map[string]bool
+	dependencies = func(name string) map[string]bool {
+		if found, ok := after[name]; ok {
+			return found
+		}
+
+		found := map[string]bool{}
+		for _, dependency := range byName[name].Config.DependsOn {
+			dependency = strings.ToLower(dependency)
+
+			found[dependency] = true
+			for indirect := range dependencies(dependency) {
+				found[indirect] = true
+			}
+		}
+
+		after[name] = found
+		return found
+	}
+
+	var errs ConfigErrors
+
+	for i, job := range jobs {
+		for _, other := range jobs[:i] {
+			if !job.Config.Log || !other.Config.Log || filepath.Clean(job.Config.LogName) != filepath.Clean(other.Config.LogName) {
+				continue
+			}
+
+			if !job.Config.LogOverwrite && !other.Config.LogOverwrite {
+				continue
+			}
+
+			name, otherName := strings.ToLower(job.Name), strings.ToLower(other.Name)
+			if dependencies(name)[otherName] || dependencies(otherName)[name] {
+				continue
+			}
+
+			errs = append(errs, &FieldError{Field: jobPrefix(jobs, job) + "LogName",
+				Err: fmt.Errorf("shared with job %q which may run at the same time and one of them overwrites it", other.Name)})
+		}
+	}
+
+	return errs
+}
+
+// checkExecutable makes sure path names a file the current user may execute. A bare name is looked up as the command
+// line does, see LookupExecutable.
+func checkExecutable(path string) error {
+	resolved, err := LookupExecutable(path)
+	if err != nil {
+		return err
+	}
+
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return err
+	}
+
+	if info.IsDir() {
+		return fmt.Errorf("%s is a directory", path)
+	}
+
+	if !isExecutable(info) {
+		return fmt.Errorf("%s is not executable", path)
+	}
+
+	return nil
+}
+
+// checkWritable makes sure a file may be written to path, without changing an existing file or leaving a new one
+func checkWritable(path string) error {
+	if _, err := os.Stat(path); err == nil {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+
+		return f.Close()
+	}
+
+	dir := filepath.Dir(path)
+	if _, err := os.Stat(dir); err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(dir, ".heimdall")
+	if err != nil {
+		return fmt.Errorf("directory %s is not writable", dir)
+	}
+
+	f.Close()
+	return os.Remove(f.Name())
+}
@@ -0,0 +1,79 @@
+package bifrost
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	assert.Nil(t, ManagerConfig{AbsolutePath: "/bin/true", Repeat: 1, InParallelCount: 1}.Validate())
+
+	// a program named rather than given by path is found on the PATH
+	assert.Nil(t, ManagerConfig{AbsolutePath: "true", Repeat: 1, InParallelCount: 1}.Validate())
+
+	err := ManagerConfig{
+		AbsolutePath:     "/bin",
+		ProgramArguments: []string{"{{.Instance"},
+		TimeoutString:    "5x",
+		InParallelCount:  1,
+		Log:              true,
+		LogName:          "/nonexistent/heimdall.log",
+		StdinParent:      "sideways",
+	}.Validate()
+
+	var fields []string
+	for _, fieldErr := range err.(ConfigErrors) {
+		fields = append(fields, fieldErr.Field)
+	}
+
+	assert.Equal(t, []string{"AbsolutePath", "ProgramArguments", "TimeoutString", "Repeat", "LogName", "StdinParent"}, fields)
+}
+
+func TestValidateJobs(t *testing.T) {
+	program := func(repeat int, dependsOn ...string) ManagerConfig {
+		return ManagerConfig{AbsolutePath: "/bin/true", Repeat: repeat, InParallelCount: 1, DependsOn: dependsOn}
+	}
+
+	err := ValidateJobs([]Job{
+		{Name: "seed", Config: program(0)},
+		{Name: "load", Config: program(1, "missing")},
+	})
+
+	assert.Equal(t, "Jobs.seed.Repeat: must be at least 1\nJobs.load.DependsOn: unknown job \"missing\"", err.Error())
+
+	err = ValidateJobs([]Job{
+		{Name: "a", Config: program(1, "b")},
+		{Name: "b", Config: program(1, "a")},
+	})
+
+	assert.Equal(t, "Jobs: job dependency cycle: a -> b -> a", err.Error())
+
+	assert.Nil(t, ValidateJobs([]Job{{Name: DefaultJob, Config: program(1)}}))
+
+	// jobs running at the same time can't both read heimdall's stdin, nor share a log one of them overwrites
+	reader := program(1)
+	reader.StdinParent = StdinFanOut
+
+	logged := func(overwrite bool, dependsOn ...string) ManagerConfig {
+		config := program(1, dependsOn...)
+		config.Log, config.LogName, config.LogOverwrite = true, filepath.Join(t.TempDir(), "heimdall.log"), overwrite
+
+		return config
+	}
+
+	err = ValidateJobs([]Job{{Name: "a", Config: reader}, {Name: "b", Config: reader}})
+	assert.Equal(t, "Jobs.b.StdinParent: job \"a\" already reads heimdall's stdin", err.Error())
+
+	shared := logged(true)
+	appended := logged(false)
+	appended.LogName = shared.LogName
+
+	err = ValidateJobs([]Job{{Name: "a", Config: shared}, {Name: "b", Config: appended}})
+	assert.Equal(t, "Jobs.b.LogName: shared with job \"a\" which may run at the same time and one of them overwrites it", err.Error())
+
+	// one after the other they may
+	appended.DependsOn = []string{"a"}
+	assert.Nil(t, ValidateJobs([]Job{{Name: "a", Config: shared}, {Name: "b", Config: appended}}))
+}
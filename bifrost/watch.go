@@ -0,0 +1,422 @@
+// Copyright 2019 John Darrington johnw.darrington@gmail.com
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License
+
+package bifrost
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// defaultDebounce is how long Watch waits for changes to settle when no Debounce is configured
+const defaultDebounce = 200 * time.Millisecond
+
+// WatchConfig configures Watch. Paths are files, directories or globs relative to the current directory, a
+// directory covering every file below it and "**" in a glob matching any number of directories - e.g "cmd" or
+// "src/**/*.go". The current directory is watched when no path is set. Hidden directories, such as .git, are only
+// watched when named. The files heimdall writes itself and the build's output never count as changes.
+//
+// Debounce is how long no further change must be seen before the program is restarted, as a Go duration, it
+// defaults to 200ms. Build is a shell command run every time before the program is started, the program isn't
+// started when it fails.
+type WatchConfig struct {
+	Paths    []string
+	Debounce string
+	Build    string
+}
+
+// watchPattern is a single watched path
+type watchPattern struct {
+	// root is the directory watched for the pattern, along with every directory below it when recursive
+	root      string
+	recursive bool
+
+	// file is set when a single file is watched and glob when a glob is, every file below root matches otherwise
+	file string
+	glob string
+}
+
+// newWatchPattern resolves a watched path against the current directory
+func newWatchPattern(path string) (watchPattern, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return watchPattern{}, err
+	}
+
+	if !hasMeta(abs) {
+		if info, err := os.Stat(abs); err == nil && info.IsDir() {
+			return watchPattern{root: abs, recursive: true}, nil
+		}
+
+		// the file may not exist yet, or be replaced rather than written to by editors, so its directory is watched
+		return watchPattern{root: filepath.Dir(abs), file: abs}, nil
+	}
+
+	if _, err := filepath.Match(abs, ""); err != nil {
+		return watchPattern{}, fmt.Errorf("%s: %s", path, err)
+	}
+
+	root := abs
+	for hasMeta(root) {
+		root = filepath.Dir(root)
+	}
+
+	return watchPattern{root: root, recursive: true, glob: abs}, nil
+}
+
+func hasMeta(path string) bool {
+	return strings.ContainsAny(path, "*?[")
+}
+
+// matches reports whether a change to the absolute path concerns the pattern
+func (p watchPattern) matches(path string) bool {
+	switch {
+	case p.file != "":
+		return path == p.file
+	case p.glob != "":
+		return matchGlob(strings.Split(p.glob, string(filepath.Separator)), strings.Split(path, string(filepath.Separator)))
+	default:
+		return path == p.root || strings.HasPrefix(path, p.root+string(filepath.Separator))
+	}
+}
+
+// matchGlob matches a path against a glob segment by segment, a "**" segment matching any number of segments
+func matchGlob(pattern, path []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(path); i++ {
+				if matchGlob(pattern[1:], path[i:]) {
+					return true
+				}
+			}
+
+			return false
+		}
+
+		if len(path) == 0 {
+			return false
+		}
+
+		if ok, _ := filepath.Match(pattern[0], path[0]); !ok {
+			return false
+		}
+
+		pattern, path = pattern[1:], path[1:]
+	}
+
+	return len(path) == 0
+}
+
+// watcher turns changes to the watched paths into restarts of the program
+type watcher struct {
+	config   ManagerConfig
+	debounce time.Duration
+	patterns []watchPattern
+	hooks    *hooks
+
+	// ignored holds the absolute paths heimdall writes to itself, which would otherwise restart the program
+	// every time it runs
+	ignored map[string]bool
+
+	fs *fsnotify.Watcher
+}
+
+func newWatcher(config ManagerConfig) (*watcher, error) {
+	w := &watcher{config: config, debounce: defaultDebounce}
+
+	if config.Watch.Debounce != "" {
+		debounce, err := time.ParseDuration(config.Watch.Debounce)
+		if err != nil {
+			return nil, err
+		}
+
+		w.debounce = debounce
+	}
+
+	paths := config.Watch.Paths
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	for _, path := range paths {
+		pattern, err := newWatchPattern(path)
+		if err != nil {
+			return nil, err
+		}
+
+		w.patterns = append(w.patterns, pattern)
+	}
+
+	w.ignored = ignoredPaths(config)
+
+	var err error
+	if w.hooks, err = newHooks(config); err != nil {
+		return nil, err
+	}
+
+	if w.fs, err = fsnotify.NewWatcher(); err != nil {
+		return nil, err
+	}
+
+	for _, pattern := range w.patterns {
+		if err := w.add(pattern.root, pattern.recursive); err != nil {
+			w.fs.Close()
+			return nil, err
+		}
+	}
+
+	return w, nil
+}
+
+// ignoredPaths returns the absolute paths of the files heimdall writes while watching - the log, report, PidFile and
+// control socket along with whatever the build writes through "-o" or "--output", e.g "go build -o bin/tool ."
+func ignoredPaths(config ManagerConfig) map[string]bool {
+	paths := []string{config.LogName, config.ReportName, PidFile}
+
+	if strings.HasPrefix(config.ControlAddr, unixPrefix) {
+		paths = append(paths, strings.TrimPrefix(config.ControlAddr, unixPrefix))
+	}
+
+	// the build runs in the program's working directory
+	fields := strings.Fields(config.Watch.Build)
+	for i, field := range fields {
+		output := ""
+
+		switch {
+		case (field == "-o" || field == "--output") && i+1 < len(fields):
+			output = fields[i+1]
+		case strings.HasPrefix(field, "-o="):
+			output = strings.TrimPrefix(field, "-o=")
+		case strings.HasPrefix(field, "--output="):
+			output = strings.TrimPrefix(field, "--output=")
+		}
+
+		if output == "" {
+			continue
+		}
+
+		if !filepath.IsAbs(output) {
+			output = filepath.Join(config.WorkingDir, output)
+		}
+
+		paths = append(paths, output)
+	}
+
+	ignored := map[string]bool{}
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+
+		if abs, err := filepath.Abs(path); err == nil {
+			ignored[abs] = true
+		}
+	}
+
+	return ignored
+}
+
+// add watches a directory, along with every directory below it but hidden ones when recursive
+func (w *watcher) add(dir string, recursive bool) error {
+	if !recursive {
+		return w.fs.Add(dir)
+	}
+
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() {
+			return nil
+		}
+
+		if path != dir && strings.HasPrefix(info.Name(), ".") {
+			return filepath.SkipDir
+		}
+
+		return w.fs.Add(path)
+	})
+}
+
+// created watches a directory created below a recursively watched one
+func (w *watcher) created(path string) {
+	info, err := os.Stat(path)
+	if err != nil || !info.IsDir() || strings.HasPrefix(info.Name(), ".") {
+		return
+	}
+
+	for _, pattern := range w.patterns {
+		if pattern.recursive && strings.HasPrefix(path, pattern.root+string(filepath.Separator)) {
+			if err := w.add(path, true); err != nil {
+				fmt.Fprintf(os.Stderr, "heimdall: watch: %s\n", err)
+			}
+
+			return
+		}
+	}
+}
+
+func (w *watcher) matches(path string) bool {
+	for _, pattern := range w.patterns {
+		if pattern.matches(path) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// listen sends the path of the latest change to changes once no further change was seen for the debounce period
+func (w *watcher) listen(changes chan<- string) {
+	var settled <-chan time.Time
+	var changed string
+
+	for {
+		select {
+		case event, ok := <-w.fs.Events:
+			if !ok {
+				return
+			}
+
+			if event.Op&fsnotify.Create != 0 {
+				w.created(event.Name)
+			}
+
+			// editors and build tools touch permissions without changing anything
+			if event.Op == fsnotify.Chmod || w.ignored[event.Name] || !w.matches(event.Name) {
+				continue
+			}
+
+			changed = event.Name
+			settled = time.After(w.debounce)
+		case err, ok := <-w.fs.Errors:
+			if !ok {
+				return
+			}
+
+			fmt.Fprintf(os.Stderr, "heimdall: watch: %s\n", err)
+		case <-settled:
+			settled = nil
+
+			// a restart already waiting covers this change as well
+			select {
+			case changes <- changed:
+			default:
+			}
+		}
+	}
+}
+
+// iteration builds and runs the program once, the build and any run are killed when ctx is done
+func (w *watcher) iteration(ctx context.Context) {
+	if w.config.Watch.Build != "" {
+		if err := w.hooks.runContext(ctx, "build", w.config.Watch.Build, w.hooks.baseEnvironment()); err != nil {
+			if ctx.Err() == nil {
+				fmt.Fprintf(os.Stderr, "heimdall: %s\n", err)
+			}
+
+			return
+		}
+	}
+
+	if _, err := execute(ctx, "", w.config); err != nil && ctx.Err() == nil {
+		fmt.Fprintf(os.Stderr, "heimdall: %s\n", err)
+	}
+}
+
+// Watch runs the program as configured, then runs it again every time a watched file changes until heimdall is
+// interrupted, see WatchConfig. A run still going when a change is seen is killed, along with a running build,
+// before the program is restarted.
+func Watch(config ManagerConfig) error {
+	w, err := newWatcher(config)
+	if err != nil {
+		return err
+	}
+
+	defer w.fs.Close()
+
+	metrics, err := serveMetrics(config.MetricsAddr)
+	if err != nil {
+		return err
+	}
+
+	changes := make(chan string, 1)
+	go w.listen(changes)
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+
+	w.run(changes, interrupt, metrics)
+
+	return nil
+}
+
+// run runs iteration after iteration, restarting on every change until interrupted
+func (w *watcher) run(changes <-chan string, interrupt <-chan os.Signal, metrics *metrics) {
+	for {
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+
+		go func() {
+			defer close(done)
+			w.iteration(ctx)
+		}()
+
+		select {
+		case path := <-changes:
+			cancel()
+			<-done
+			fmt.Printf("heimdall: %s changed, restarting\n", relativePath(path))
+			metrics.restarted()
+		case <-done:
+			cancel()
+			fmt.Println("heimdall: waiting for changes")
+
+			select {
+			case path := <-changes:
+				fmt.Printf("heimdall: %s changed, running again\n", relativePath(path))
+				metrics.restarted()
+			case <-interrupt:
+				return
+			}
+		case <-interrupt:
+			cancel()
+			<-done
+			return
+		}
+	}
+}
+
+// relativePath shortens a path below the current directory for display
+func relativePath(path string) string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return path
+	}
+
+	if rel, err := filepath.Rel(wd, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+
+	return path
+}
@@ -0,0 +1,158 @@
+package bifrost
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatchPattern(t *testing.T) {
+	dir, err := ioutil.TempDir("", "heimdall")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	pattern, err := newWatchPattern(dir)
+	assert.Nil(t, err)
+	assert.True(t, pattern.recursive)
+	assert.True(t, pattern.matches(filepath.Join(dir, "cmd", "root.go")))
+	assert.False(t, pattern.matches(dir+"-other"))
+
+	pattern, err = newWatchPattern(filepath.Join(dir, "main.go"))
+	assert.Nil(t, err)
+	assert.Equal(t, dir, pattern.root)
+	assert.True(t, pattern.matches(filepath.Join(dir, "main.go")))
+	assert.False(t, pattern.matches(filepath.Join(dir, "main_test.go")))
+
+	pattern, err = newWatchPattern(filepath.Join(dir, "src", "**", "*.go"))
+	assert.Nil(t, err)
+	assert.Equal(t, filepath.Join(dir, "src"), pattern.root)
+	assert.True(t, pattern.matches(filepath.Join(dir, "src", "main.go")))
+	assert.True(t, pattern.matches(filepath.Join(dir, "src", "cmd", "root", "root.go")))
+	assert.False(t, pattern.matches(filepath.Join(dir, "src", "readme.md")))
+	assert.False(t, pattern.matches(filepath.Join(dir, "main.go")))
+
+	_, err = newWatchPattern(filepath.Join(dir, "[a-"))
+	assert.NotNil(t, err)
+}
+
+func TestWatcher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "heimdall")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	w, err := newWatcher(ManagerConfig{Watch: WatchConfig{Paths: []string{filepath.Join(dir, "**", "*.go")}, Debounce: "50ms"}})
+	assert.Nil(t, err)
+	defer w.fs.Close()
+
+	changes := make(chan string, 1)
+	go w.listen(changes)
+
+	// files in directories created after the watch started are seen as well
+	assert.Nil(t, os.Mkdir(filepath.Join(dir, "cmd"), 0755))
+	time.Sleep(50 * time.Millisecond)
+
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "cmd", "notes.txt"), []byte("ignored"), 0644))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "cmd", "root.go"), []byte("package cmd"), 0644))
+
+	select {
+	case path := <-changes:
+		assert.Equal(t, filepath.Join(dir, "cmd", "root.go"), path)
+	case <-time.After(2 * time.Second):
+		t.Fatal("no change seen")
+	}
+}
+
+func TestWatcherIgnoresOwnFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "heimdall")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	assert.Nil(t, os.Mkdir(filepath.Join(dir, "bin"), 0755))
+
+	w, err := newWatcher(ManagerConfig{
+		Log:        true,
+		LogName:    filepath.Join(dir, "heimdall.log"),
+		WorkingDir: dir,
+		Watch:      WatchConfig{Paths: []string{dir}, Debounce: "50ms", Build: "go build -o bin/tool ."},
+	})
+	assert.Nil(t, err)
+	defer w.fs.Close()
+
+	changes := make(chan string, 1)
+	go w.listen(changes)
+
+	// neither the log heimdall writes nor the program the build writes are changes
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "heimdall.log"), []byte("[H-PID:1]  hi\n"), 0644))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "bin", "tool"), []byte("built"), 0755))
+
+	select {
+	case path := <-changes:
+		t.Fatalf("%s was seen as a change", path)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "main.go"), []byte("package main"), 0644))
+
+	select {
+	case path := <-changes:
+		assert.Equal(t, filepath.Join(dir, "main.go"), path)
+	case <-time.After(2 * time.Second):
+		t.Fatal("no change seen")
+	}
+}
+
+func TestWatchRestarts(t *testing.T) {
+	for name, config := range map[string]ManagerConfig{
+		"repeat":   {},
+		"soak":     {For: "1h"},
+		"schedule": {Schedule: ScheduleConfig{Every: "1h"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			starts := filepath.Join(dir, "starts")
+
+			config.ShellCommand = "echo start >> starts; sleep 10"
+			config.WorkingDir = dir
+			config.Repeat = 1
+			config.InParallelCount = 1
+			config.Watch = WatchConfig{Paths: []string{filepath.Join(dir, "*.go")}}
+
+			w, err := newWatcher(config)
+			assert.Nil(t, err)
+			defer w.fs.Close()
+
+			started := func(count int) bool {
+				content, _ := ioutil.ReadFile(starts)
+				return strings.Count(string(content), "start") == count
+			}
+
+			changes := make(chan string, 1)
+			interrupt := make(chan os.Signal, 1)
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				w.run(changes, interrupt, nil)
+			}()
+
+			assert.Eventually(t, func() bool { return started(1) }, 5*time.Second, 10*time.Millisecond)
+
+			// the running program is killed and started again rather than left to finish
+			changes <- filepath.Join(dir, "main.go")
+			assert.Eventually(t, func() bool { return started(2) }, 5*time.Second, 10*time.Millisecond)
+
+			interrupt <- os.Interrupt
+
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("watching didn't stop once interrupted")
+			}
+		})
+	}
+}
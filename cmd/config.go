@@ -0,0 +1,289 @@
+/*
+Copyright © 2019 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dnoberon/heimdall/bifrost"
+	"github.com/pelletier/go-toml/v2"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// configCmd represents the config command
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect heimdall's configuration",
+}
+
+// configShowCmd represents the config show command
+var configShowCmd = &cobra.Command{
+	Use:   "show [job...]",
+	Args:  cobra.ArbitraryArgs,
+	Short: "Print the effective configuration after merging flags, environment variables and the configuration file",
+	Long: `Show prints the configuration heimdall would run with, once the
+configuration file, HEIMDALL_ prefixed environment variables and
+flags have been merged. Every job of the configuration file is
+printed with its defaults filled in, name jobs to only print those.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		jobs, err := effectiveJobs(cmd)
+		if err != nil {
+			exitInvalid(err)
+		}
+
+		if len(args) > 0 {
+			if jobs, err = bifrost.SelectJobs(jobs, args, false); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		var show interface{} = jobs[0].Config
+		if len(jobs) > 1 || jobs[0].Name != bifrost.DefaultJob {
+			named := map[string]bifrost.ManagerConfig{}
+			for _, job := range jobs {
+				named[job.Name] = job.Config
+			}
+
+			show = map[string]interface{}{"Jobs": named}
+		}
+
+		format, _ := cmd.Flags().GetString("format")
+		if err := encodeConfig(os.Stdout, format, show); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+// configSchemaCmd represents the config schema command
+var configSchemaCmd = &cobra.Command{
+	Use:   "schema",
+	Args:  cobra.NoArgs,
+	Short: "Print the JSON Schema of heimdall's configuration files",
+	Long: `Schema prints a JSON Schema describing heimdall's configuration
+files, for editors to offer completion and validation with. The
+schema describes the fields of a configuration file as written,
+e.g TimeoutString rather than Timeout`,
+	Run: func(cmd *cobra.Command, args []string) {
+		schema, err := json.MarshalIndent(bifrost.Schema(), "", "  ")
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		fmt.Println(string(schema))
+	},
+}
+
+// effectiveJobs returns the jobs of the configuration file, or a single job built from flags and environment
+// variables alone when there is no configuration file
+func effectiveJobs(cmd *cobra.Command) ([]bifrost.Job, error) {
+	if viper.ConfigFileUsed() != "" {
+		return loadJobs(cmd)
+	}
+
+	config, err := jobConfig(cmd, map[string]interface{}{})
+	if err != nil {
+		return nil, jobErrors(bifrost.DefaultJob, 1, err)
+	}
+
+	return []bifrost.Job{{Name: bifrost.DefaultJob, Config: config}}, nil
+}
+
+// encodeConfig writes a configuration in the json, yaml or toml format. Fields without a value are left out of yaml
+// and toml, as toml has no way to express them.
+func encodeConfig(w io.Writer, format string, config interface{}) error {
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if format == "json" {
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var settings map[string]interface{}
+	if err := decoder.Decode(&settings); err != nil {
+		return err
+	}
+
+	settings = plainSettings(settings).(map[string]interface{})
+
+	switch format {
+	case "yaml", "yml":
+		return yaml.NewEncoder(w).Encode(settings)
+	case "toml":
+		return toml.NewEncoder(w).Encode(settings)
+	default:
+		return fmt.Errorf("unknown format %q, expected json, yaml or toml", format)
+	}
+}
+
+// writeConfig writes a configuration to path in the given format, or the format matching the file's extension when
+// none is given
+func writeConfig(path, format string, config interface{}) error {
+	if format == "" {
+		format = configFormat(path)
+	}
+
+	out := &bytes.Buffer{}
+	if err := encodeConfig(out, format, config); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, out.Bytes(), 0644)
+}
+
+// structuredFlags maps the flags building structured configuration values to the keys they set, these aren't
+// bound to their keys like configFlags but parsed on their own
+var structuredFlags = map[string]string{
+	"matrix":    "Matrix",
+	"rampStage": "Ramp.Stages",
+}
+
+// userSettings returns the settings of a configuration which the user set - those in settings, as read from a
+// configuration file, those of the flags set on cmd and any key in set. Defaults and environment variables are
+// left out so they keep applying to the configuration once it's written.
+func userSettings(cmd *cobra.Command, config bifrost.ManagerConfig, settings map[string]interface{}, set map[string]bool) (map[string]interface{}, error) {
+	keys := map[string]bool{}
+	settingKeys(settings, "", keys)
+
+	for key, ok := range set {
+		keys[strings.ToLower(key)] = ok
+	}
+
+	cmd.Flags().Visit(func(flag *pflag.Flag) {
+		if key, ok := configFlags[flag.Name]; ok {
+			keys[strings.ToLower(key)] = true
+		}
+
+		if key, ok := structuredFlags[flag.Name]; ok {
+			keys[strings.ToLower(key)] = true
+		}
+	})
+
+	data, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var all map[string]interface{}
+	if err := decoder.Decode(&all); err != nil {
+		return nil, err
+	}
+
+	return keptSettings(all, "", keys), nil
+}
+
+// settingKeys adds the lower case, dotted, key of every value in settings to keys - e.g hooks.beforeall
+func settingKeys(settings map[string]interface{}, prefix string, keys map[string]bool) {
+	for key, value := range settings {
+		if nested, ok := value.(map[string]interface{}); ok {
+			settingKeys(nested, prefix+key+".", keys)
+			continue
+		}
+
+		keys[strings.ToLower(prefix+key)] = true
+	}
+}
+
+// keptSettings returns the settings whose lower case, dotted, keys are among keys, along with the sections holding
+// them
+func keptSettings(settings map[string]interface{}, prefix string, keys map[string]bool) map[string]interface{} {
+	kept := map[string]interface{}{}
+
+	for key, value := range settings {
+		full := strings.ToLower(prefix + key)
+		if keys[full] {
+			kept[key] = value
+			continue
+		}
+
+		if nested, ok := value.(map[string]interface{}); ok {
+			if nested = keptSettings(nested, full+".", keys); len(nested) > 0 {
+				kept[key] = nested
+			}
+		}
+	}
+
+	return kept
+}
+
+// configFormat returns the format of a configuration file judging by its extension, json unless it is yaml or toml
+func configFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return "yaml"
+	case ".toml":
+		return "toml"
+	default:
+		return "json"
+	}
+}
+
+// plainSettings removes every setting without a value and turns json numbers back into integers where possible
+func plainSettings(value interface{}) interface{} {
+	switch value := value.(type) {
+	case json.Number:
+		if i, err := value.Int64(); err == nil {
+			return i
+		}
+
+		f, _ := value.Float64()
+		return f
+	case []interface{}:
+		for i, item := range value {
+			value[i] = plainSettings(item)
+		}
+	case map[string]interface{}:
+		for k, item := range value {
+			if item == nil {
+				delete(value, k)
+				continue
+			}
+
+			value[k] = plainSettings(item)
+		}
+	}
+
+	return value
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configShowCmd)
+	configCmd.AddCommand(configSchemaCmd)
+
+	configShowCmd.Flags().String("format", "json", "Print the configuration as json, yaml or toml")
+	addConfigFileFlag(configShowCmd.Flags())
+	addConfigFlags(configShowCmd.Flags())
+}
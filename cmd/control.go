@@ -0,0 +1,135 @@
+/*
+Copyright © 2019 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/dnoberon/heimdall/bifrost"
+	"github.com/spf13/cobra"
+)
+
+// statusCmd represents the status command
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Args:  cobra.NoArgs,
+	Short: "Show the instances of the heimdall running in the current directory",
+	Long: `Status connects to the heimdall running in the current directory
+and shows whether it is paused, how many runs it may run at once
+and every running instance with its run, repetition, PID and
+uptime. The running heimdall must have been started with
+--controlAddr, it is found through the heimdall.pid file it
+writes to its working directory`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := controller(cmd).Status(os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+// logsCmd represents the logs command
+var logsCmd = &cobra.Command{
+	Use:   "logs <instance>",
+	Args:  cobra.ExactArgs(1),
+	Short: "Print an instance's latest output from the heimdall running in the current directory",
+	Long: `Logs prints the latest lines an instance of the heimdall running
+in the current directory wrote, stdout to stdout and stderr to
+stderr. Up to 200 lines are kept per instance, across the runs
+the instance made. With --follow new output keeps being printed
+until the running heimdall exits`,
+	Run: func(cmd *cobra.Command, args []string) {
+		follow, _ := cmd.Flags().GetBool("follow")
+		lines, _ := cmd.Flags().GetInt("lines")
+
+		if err := controller(cmd).Logs(os.Stdout, os.Stderr, instanceArg(args[0]), lines, follow); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+// killCmd represents the kill command
+var killCmd = &cobra.Command{
+	Use:   "kill <instance>",
+	Args:  cobra.ExactArgs(1),
+	Short: "Kill an instance's running program in the heimdall running in the current directory",
+	Long: `Kill kills the program an instance of the heimdall running in
+the current directory is running, the run being reported as
+killed. The rest of the execution carries on. With --restart the
+run is started again once killed`,
+	Run: func(cmd *cobra.Command, args []string) {
+		restart, _ := cmd.Flags().GetBool("restart")
+
+		if err := controller(cmd).Kill(os.Stdout, instanceArg(args[0]), restart); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+// scaleCmd represents the scale command
+var scaleCmd = &cobra.Command{
+	Use:   "scale <parallelCount>",
+	Args:  cobra.ExactArgs(1),
+	Short: "Change how many runs the heimdall running in the current directory may run at once",
+	Long: `Scale changes the parallelCount of the heimdall running in the
+current directory. Scaling up starts more runs straight away,
+scaling down lets running runs finish. Without a matrix each
+repetition still queued runs once per instance. A ramp decides
+its concurrency itself and can't be scaled`,
+	Run: func(cmd *cobra.Command, args []string) {
+		parallel, err := strconv.Atoi(args[0])
+		if err != nil {
+			log.Fatalf("invalid parallelCount %q: %s", args[0], err)
+		}
+
+		if err := controller(cmd).Scale(os.Stdout, parallel); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+// controller finds the heimdall running in the current directory, addressing the job given by --job
+func controller(cmd *cobra.Command) *bifrost.Controller {
+	c, err := bifrost.FindController()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	c.Job, _ = cmd.Flags().GetString("job")
+
+	return c
+}
+
+func instanceArg(arg string) int {
+	instance, err := strconv.Atoi(arg)
+	if err != nil {
+		log.Fatalf("invalid instance %q: %s", arg, err)
+	}
+
+	return instance
+}
+
+func init() {
+	for _, command := range []*cobra.Command{statusCmd, logsCmd, killCmd, scaleCmd} {
+		rootCmd.AddCommand(command)
+		command.Flags().String("job", "", "Address a single job when the running heimdall runs a pipeline")
+	}
+
+	logsCmd.Flags().BoolP("follow", "f", false, "Keep printing new output until the running heimdall exits")
+	logsCmd.Flags().IntP("lines", "n", 0, "Print at most this many of the latest lines, every line kept by default")
+	killCmd.Flags().Bool("restart", false, "Start the run again once it was killed")
+}
@@ -0,0 +1,48 @@
+/*
+Copyright © 2019 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/dnoberon/heimdall/bifrost"
+	"github.com/spf13/cobra"
+)
+
+// execCmd is how heimdall starts a run's program with rlimits set, heimdall starting itself with the command and
+// replacing itself with the program once they are set. It isn't meant to be run by hand.
+var execCmd = &cobra.Command{
+	Use:    bifrost.LimitedExecCommand + " <rlimits> <program> <name> [argument...]",
+	Args:   cobra.MinimumNArgs(3),
+	Hidden: true,
+
+	// the program's arguments are its own, as is the environment
+	DisableFlagParsing: true,
+	PersistentPreRun:   func(cmd *cobra.Command, args []string) {},
+
+	Run: func(cmd *cobra.Command, args []string) {
+		err := bifrost.ExecLimited(args)
+
+		// like a shell failing to run a command
+		fmt.Fprintf(os.Stderr, "heimdall: %s\n", err)
+		os.Exit(126)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(execCmd)
+}
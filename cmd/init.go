@@ -17,22 +17,21 @@ package cmd
 
 import (
 	"errors"
-	"io/ioutil"
+	"fmt"
 	"log"
 	"os"
-	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
 	"time"
 
-	"github.com/segmentio/objconv/json"
-
 	"github.com/dnoberon/heimdall/bifrost"
 
 	"github.com/manifoldco/promptui"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
 )
 
 // initCmd represents the init command
@@ -43,34 +42,161 @@ var initCmd = &cobra.Command{
 	Long: `Init creates a "heimdall_config.json" in the current directory. This configuration
 will be read in when using the "heimdall run" command and
 should take the place of any command flags you would use
-normally`,
-	Run: func(cmd *cobra.Command, args []string) {
-		config := bifrost.ManagerConfig{}
+normally
+
+Every value may also be given as a flag, values given this way
+are not prompted for. With --nonInteractive nothing is prompted
+for at all, making init usable from scripts.
+
+An existing configuration file is edited rather than replaced,
+its values are offered as the defaults of every prompt. Choose
+where the configuration is written with --output, the file's
+extension picks json, yaml or toml unless --format is given.
 
-		promptProgramPath(&config)
-		promptProgramArguments(&config)
-		promptRepeat(&config)
-		promptTimeout(&config)
-		promptParallel(&config)
-		promptVerbose(&config)
-		promptLog(&config)
+Only values you gave, as flags, answers or in the file being
+edited, are written - anything else keeps heimdall's defaults`,
+	Run: func(cmd *cobra.Command, args []string) {
+		output, _ := cmd.Flags().GetString("output")
+		format, _ := cmd.Flags().GetString("format")
+		nonInteractive, _ := cmd.Flags().GetBool("nonInteractive")
+
+		if output == "" {
+			output = "heimdall_config.json"
+			if format != "" {
+				output = "heimdall_config." + format
+			}
+		}
 
-		configFile, err := json.Marshal(config)
+		settings, editing, err := existingSettings(output)
 		if err != nil {
 			log.Fatal(err)
 		}
 
-		err = ioutil.WriteFile("heimdall_config.json", configFile, os.ModePerm)
+		config, err := jobConfig(cmd, settings)
+		if err != nil {
+			exitInvalid(jobErrors(bifrost.DefaultJob, 1, err))
+		}
+
+		// the keys written besides those of the file being edited and of the flags the user set
+		set := map[string]bool{}
+
+		if program, _ := cmd.Flags().GetString("program"); program != "" {
+			if config.AbsolutePath, err = bifrost.LookupExecutable(program); err != nil {
+				log.Fatal(err)
+			}
+
+			set["AbsolutePath"] = true
+		}
+
+		if cmd.Flags().Changed("arguments") {
+			config.ProgramArguments, _ = cmd.Flags().GetStringArray("arguments")
+			set["ProgramArguments"] = true
+		}
+
+		if !nonInteractive {
+			// values already given, as flags or by the file being edited, become the defaults of their prompts
+			p := prompter{flags: cmd.Flags(), editing: editing, answered: set}
+
+			p.promptProgramPath(&config)
+			p.promptProgramArguments(&config)
+			p.promptWorkingDir(&config)
+			p.promptEnv(&config)
+			p.promptRepeat(&config)
+			p.promptTimeout(&config)
+			p.promptParallel(&config)
+			p.promptVerbose(&config)
+			p.promptLog(&config)
+		}
+
+		if err := config.Validate(); err != nil {
+			exitInvalid(err)
+		}
+
+		written, err := userSettings(cmd, config, settings, set)
 		if err != nil {
 			log.Fatal(err)
 		}
+
+		if err := writeConfig(output, format, written); err != nil {
+			log.Fatal(err)
+		}
+
+		fmt.Printf("heimdall: configuration written to %s\n", output)
 	},
 }
 
-func promptProgramPath(config *bifrost.ManagerConfig) {
+// existingSettings returns the settings of the configuration file at output which init edits, if there is one.
+// Values are returned as written, without interpolation, so that ${VAR} references survive editing. Files
+// describing several jobs can't be edited by init.
+func existingSettings(output string) (map[string]interface{}, bool, error) {
+	if _, err := os.Stat(output); err != nil {
+		return map[string]interface{}{}, false, nil
+	}
+
+	v := viper.New()
+	v.SetConfigFile(output)
+
+	if err := v.ReadInConfig(); err != nil {
+		return nil, false, err
+	}
+
+	settings := v.AllSettings()
+	if _, ok := settings["jobs"]; ok {
+		return nil, false, fmt.Errorf("%s describes several jobs, init only edits single program configurations", output)
+	}
+
+	return settings, true, nil
+}
+
+// prompter asks for every value not given as a flag. Prompts default to the configuration's current values when
+// editing an existing file, or when the value came from a flag or environment variable. The key of every value
+// asked for is added to answered.
+type prompter struct {
+	flags    *pflag.FlagSet
+	editing  bool
+	answered map[string]bool
+}
+
+// answer records the keys of values the user was asked for
+func (p prompter) answer(keys ...string) {
+	for _, key := range keys {
+		p.answered[key] = true
+	}
+}
+
+// skip reports whether a value was given as one of flags and shouldn't be prompted for
+func (p prompter) skip(flags ...string) bool {
+	for _, flag := range flags {
+		if p.flags.Changed(flag) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// yesNo returns the default of a confirmation prompt, current if editing and fresh otherwise
+func (p prompter) yesNo(current bool, fresh string) string {
+	if !p.editing {
+		return fresh
+	}
+
+	if current {
+		return "y"
+	}
+
+	return "n"
+}
+
+func (p prompter) promptProgramPath(config *bifrost.ManagerConfig) {
+	if p.skip("program") {
+		return
+	}
+
 	prompt := promptui.Prompt{
 		Label:    "Executable path",
 		Validate: emptyValidate,
+		Default:  config.AbsolutePath,
 	}
 
 	path, err := prompt.Run()
@@ -78,17 +204,23 @@ func promptProgramPath(config *bifrost.ManagerConfig) {
 		log.Fatal(err)
 	}
 
-	absolutePath, err := filepath.Abs(path)
+	absolutePath, err := bifrost.LookupExecutable(path)
 	if err != nil {
 		log.Fatal(err)
 	}
 
 	config.AbsolutePath = absolutePath
+	p.answer("AbsolutePath")
 }
 
-func promptProgramArguments(config *bifrost.ManagerConfig) {
+func (p prompter) promptProgramArguments(config *bifrost.ManagerConfig) {
+	if p.skip("arguments") {
+		return
+	}
+
 	prompt := promptui.Prompt{
-		Label: "Program arguments separated by comma",
+		Label:   "Program arguments separated by comma",
+		Default: strings.Join(config.ProgramArguments, ","),
 	}
 
 	arguments, err := prompt.Run()
@@ -96,17 +228,88 @@ func promptProgramArguments(config *bifrost.ManagerConfig) {
 		log.Fatal(err)
 	}
 
+	p.answer("ProgramArguments")
+
 	if arguments == "" {
+		config.ProgramArguments = nil
 		return
 	}
 
 	config.ProgramArguments = strings.Split(arguments, ",")
 }
 
-func promptTimeout(config *bifrost.ManagerConfig) {
+func (p prompter) promptWorkingDir(config *bifrost.ManagerConfig) {
+	if p.skip("workingDir") {
+		return
+	}
+
+	prompt := promptui.Prompt{
+		Label:   "Working directory for your program, leave empty for the current directory",
+		Default: config.WorkingDir,
+	}
+
+	workingDir, err := prompt.Run()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	config.WorkingDir = workingDir
+	p.answer("WorkingDir")
+}
+
+func (p prompter) promptEnv(config *bifrost.ManagerConfig) {
+	if !p.skip("env") {
+		prompt := promptui.Prompt{
+			Label:    "Environment variables in KEY=VALUE form separated by comma",
+			Validate: envValidate,
+			Default:  strings.Join(config.Env, ","),
+		}
+
+		env, err := prompt.Run()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		config.Env = nil
+		if env != "" {
+			config.Env = strings.Split(env, ",")
+		}
+
+		p.answer("Env")
+	}
+
+	if p.skip("cleanEnv") {
+		return
+	}
+
+	prompt := promptui.Prompt{
+		Label:    "Start your program with a clean environment? [y/N] ",
+		Validate: confirmValidate,
+		Default:  p.yesNo(config.CleanEnv, "n"),
+	}
+
+	confirm, err := prompt.Run()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	config.CleanEnv = isYes(confirm)
+	p.answer("CleanEnv")
+}
+
+func (p prompter) promptTimeout(config *bifrost.ManagerConfig) {
+	if p.skip("timeout") {
+		return
+	}
+
+	timeout := "5m"
+	if p.editing {
+		timeout = config.TimeoutString
+	}
+
 	prompt := promptui.Prompt{
 		Label:    "How long should we wait before killing your program? - e.g 10s, 1m, 1h ",
-		Default:  "5m",
+		Default:  timeout,
 		Validate: timeValidate,
 	}
 
@@ -121,12 +324,17 @@ func promptTimeout(config *bifrost.ManagerConfig) {
 	}
 
 	config.TimeoutString = timeout
+	p.answer("TimeoutString")
 }
 
-func promptRepeat(config *bifrost.ManagerConfig) {
+func (p prompter) promptRepeat(config *bifrost.ManagerConfig) {
+	if p.skip("repeat") {
+		return
+	}
+
 	prompt := promptui.Prompt{
 		Label:    "How many times should we repeat execution?",
-		Default:  "1",
+		Default:  strconv.Itoa(config.Repeat),
 		Validate: intValidate,
 	}
 
@@ -141,12 +349,17 @@ func promptRepeat(config *bifrost.ManagerConfig) {
 	}
 
 	config.Repeat = repeatAmount
+	p.answer("Repeat")
 }
 
-func promptParallel(config *bifrost.ManagerConfig) {
+func (p prompter) promptParallel(config *bifrost.ManagerConfig) {
+	if p.skip("parallelCount") {
+		return
+	}
+
 	prompt := promptui.Prompt{
 		Label:    "How many instances of your program should we run at the same time?",
-		Default:  "1",
+		Default:  strconv.Itoa(config.InParallelCount),
 		Validate: intValidate,
 	}
 
@@ -161,13 +374,18 @@ func promptParallel(config *bifrost.ManagerConfig) {
 	}
 
 	config.InParallelCount = parallelCount
+	p.answer("InParallelCount")
 }
 
-func promptVerbose(config *bifrost.ManagerConfig) {
+func (p prompter) promptVerbose(config *bifrost.ManagerConfig) {
+	if p.skip("verbose") {
+		return
+	}
+
 	prompt := promptui.Prompt{
 		Label:    "Print all output to console? [Y/n] ",
 		Validate: confirmValidate,
-		Default:  "y",
+		Default:  p.yesNo(config.Verbose, "y"),
 	}
 
 	confirm, err := prompt.Run()
@@ -176,12 +394,17 @@ func promptVerbose(config *bifrost.ManagerConfig) {
 	}
 
 	config.Verbose = isYes(confirm)
+	p.answer("Verbose")
 }
 
-func promptLog(config *bifrost.ManagerConfig) {
+func (p prompter) promptLog(config *bifrost.ManagerConfig) {
+	if p.skip("log", "logName", "logOverwrite", "logFilter") {
+		return
+	}
+
 	prompt := promptui.Prompt{
 		Label:    "Log the output generated by your program? [Y/n] ",
-		Default:  "y",
+		Default:  p.yesNo(config.Log, "y"),
 		Validate: confirmValidate,
 	}
 
@@ -190,13 +413,16 @@ func promptLog(config *bifrost.ManagerConfig) {
 		log.Fatal(err)
 	}
 
-	if !isYes(confirm) {
+	config.Log = isYes(confirm)
+	p.answer("Log")
+
+	if !config.Log {
 		return
 	}
 
 	prompt = promptui.Prompt{
 		Label:   "What should we call the log file?",
-		Default: "heimdall.log",
+		Default: config.LogName,
 	}
 
 	logName, err := prompt.Run()
@@ -209,7 +435,7 @@ func promptLog(config *bifrost.ManagerConfig) {
 	prompt = promptui.Prompt{
 		Label:    "Overwrite existing logs? [y/N] ",
 		Validate: confirmValidate,
-		Default:  "n",
+		Default:  p.yesNo(config.LogOverwrite, "n"),
 	}
 
 	confirm, err = prompt.Run()
@@ -219,10 +445,15 @@ func promptLog(config *bifrost.ManagerConfig) {
 
 	config.LogOverwrite = isYes(confirm)
 
+	filter := ""
+	if config.LogFilter != nil {
+		filter = config.LogFilter.String()
+	}
+
 	prompt = promptui.Prompt{
 		Label:    "Filter incoming logs? [y/N] ",
 		Validate: confirmValidate,
-		Default:  "n",
+		Default:  p.yesNo(filter != "", "n"),
 	}
 
 	confirm, err = prompt.Run()
@@ -230,10 +461,13 @@ func promptLog(config *bifrost.ManagerConfig) {
 		log.Fatal(err)
 	}
 
+	p.answer("LogName", "LogOverwrite", "LogFilter")
+
+	config.LogFilter = nil
 	if isYes(confirm) {
 		prompt = promptui.Prompt{
 			Label:    "Regex expression for filtering logs",
-			Default:  "",
+			Default:  filter,
 			Validate: regexValidate,
 		}
 
@@ -282,6 +516,14 @@ func intValidate(input string) error {
 	return nil
 }
 
+func envValidate(input string) error {
+	if input == "" {
+		return nil
+	}
+
+	return bifrost.ValidateEnv(strings.Split(input, ","))
+}
+
 func regexValidate(input string) error {
 	_, err := regexp.Compile(input)
 	return err
@@ -296,6 +538,13 @@ func timeValidate(input string) error {
 func init() {
 	rootCmd.AddCommand(initCmd)
 
+	initCmd.Flags().String("program", "", "Designate the executable to run, skipping its prompt")
+	initCmd.Flags().StringArray("arguments", nil, "Designate an argument of your program, may be repeated, skipping its prompt")
+	initCmd.Flags().Bool("nonInteractive", false, "Don't prompt for anything, values not given as flags keep their current or default values")
+	initCmd.Flags().String("output", "", "Designate where the configuration is written, an existing file is edited, defaults to heimdall_config.json in the current directory")
+	initCmd.Flags().String("format", "", "Write the configuration as json, yaml or toml, defaults to the output file's extension")
+	addConfigFlags(initCmd.Flags())
+
 	// Here you will define your flags and configuration settings.
 
 	// Cobra supports Persistent Flags which will work for this command
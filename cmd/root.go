@@ -19,12 +19,12 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"path/filepath"
-	"regexp"
+	"strings"
 
 	"github.com/dnoberon/heimdall/bifrost"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 
 	"github.com/mitchellh/go-homedir"
 	"github.com/spf13/viper"
@@ -41,51 +41,91 @@ log a CLI application. Quick configuration options allow
 you to effectively test and monitor a CLI application in
 development`,
 	Args: cobra.MinimumNArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
-		absolutePath, err := filepath.Abs(args[0])
-		if err != nil {
-			log.Fatal("Unable to locate the executable provided " + err.Error())
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		// only the commands taking --config read a configuration file
+		if cmd.Flags().Lookup("config") != nil {
+			initConfig()
 		}
 
-		repeat, _ := cmd.Flags().GetInt("repeat")
-		timeout, _ := cmd.Flags().GetDuration("timeout")
-
-		parallelCount, _ := cmd.Flags().GetInt("parallelCount")
-
-		toLog, _ := cmd.Flags().GetBool("log")
-		logName, _ := cmd.Flags().GetString("logName")
-		logOverwrite, _ := cmd.Flags().GetBool("logOverwrite")
-		rawReg, _ := cmd.Flags().GetString("logFilter")
-		verbose, _ := cmd.Flags().GetBool("verbose")
-
-		config := bifrost.ManagerConfig{
-			AbsolutePath:     absolutePath,
-			Verbose:          verbose,
-			Repeat:           repeat,
-			ProgramArguments: args[1:],
-			InParallelCount:  parallelCount,
-			Log:              toLog,
-			LogName:          logName,
-			LogOverwrite:     logOverwrite,
-			Timeout:          timeout}
-
-		if rawReg != "" {
-			regex, err := regexp.Compile(rawReg)
+		return flagsFromEnv(cmd.Flags())
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		config := commandConfig(cmd, args)
+
+		if saveConfig, _ := cmd.Flags().GetString("saveConfig"); saveConfig != "" {
+			settings, err := bifrost.DefaultSettings(fileSettings())
 			if err != nil {
 				log.Fatal(err)
 			}
 
-			config.LogFilter = regex
+			// the program given replaces the configuration file's, it is written along with the flags set and the
+			// configuration file's other values
+			for _, key := range []string{"absolutepath", "shellcommand", "programarguments"} {
+				delete(settings, key)
+			}
+
+			set := map[string]bool{"AbsolutePath": config.ShellCommand == "", "ShellCommand": config.ShellCommand != "",
+				"ProgramArguments": len(config.ProgramArguments) > 0}
+
+			written, err := userSettings(cmd, config, settings, set)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			if err := writeConfig(saveConfig, "", written); err != nil {
+				log.Fatal(err)
+			}
+
+			fmt.Printf("heimdall: configuration written to %s, run it with \"heimdall run --config %s\"\n", saveConfig, saveConfig)
+			return
 		}
 
-		err = bifrost.Execute(config)
-		if err != nil {
+		if err := bifrost.Execute(config); err != nil {
 			log.Fatal(err)
 		}
 
 	},
 }
 
+// commandConfig builds the configuration of a program given on the command line, run through a shell with --shell,
+// on top of the configuration file's defaults. The configuration file's own program is kept when args are empty.
+// Heimdall exits if the configuration is invalid.
+func commandConfig(cmd *cobra.Command, args []string) bifrost.ManagerConfig {
+	settings, err := bifrost.DefaultSettings(fileSettings())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	config, err := jobConfig(cmd, settings)
+	if err != nil {
+		exitInvalid(jobErrors(bifrost.DefaultJob, 1, err))
+	}
+
+	useShell, _ := cmd.Flags().GetBool("shell")
+
+	switch {
+	case len(args) == 0:
+	case useShell:
+		config.AbsolutePath = ""
+		config.ShellCommand = strings.Join(args, " ")
+		config.ProgramArguments = nil
+	default:
+		config.AbsolutePath, err = bifrost.LookupExecutable(args[0])
+		if err != nil {
+			log.Fatal("Unable to locate the executable provided " + err.Error())
+		}
+
+		config.ShellCommand = ""
+		config.ProgramArguments = args[1:]
+	}
+
+	if err := config.Validate(); err != nil {
+		exitInvalid(err)
+	}
+
+	return config
+}
+
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
@@ -96,22 +136,25 @@ func Execute() {
 }
 
 func init() {
-	cobra.OnInitialize(initConfig)
+	addConfigFileFlag(rootCmd.Flags())
 
-	rootCmd.Flags().IntP("repeat", "r", 1, "Designate how many times to repeat your program with supplied arguments")
-	rootCmd.Flags().DurationP("timeout", "t", 0, "Designate when to kill your provided program")
+	rootCmd.Flags().Bool("shell", false, "Run the provided command through a shell, allowing pipelines and compound commands")
+	rootCmd.Flags().String("saveConfig", "", "Write this invocation to the provided configuration file instead of running it, the file's extension picks json, yaml or toml")
 
-	rootCmd.Flags().IntP("parallelCount", "p", 1, "Designate how many instances of your should run in parallel at one time")
+	addConfigFlags(rootCmd.Flags())
+}
 
-	rootCmd.Flags().BoolP("log", "l", false, "Toggle logging of provided program's stdout and stderr output to file, appends if file exists")
-	rootCmd.Flags().String("logName", "heimdall.log", "Specify the log file name, defaults to heimdall.log")
-	rootCmd.Flags().Bool("logOverwrite", false, "Toggle logging of provided program's stdout and stderr output to file")
-	rootCmd.Flags().String("logFilter", "", "Allows for log filtering via regex string. Use only valid with log flag")
-	rootCmd.Flags().BoolP("verbose", "v", false, "Toggle display of provided program's stdout and stderr output while heimdall runs")
+// addConfigFileFlag defines --config on the commands reading a configuration file
+func addConfigFileFlag(flags *pflag.FlagSet) {
+	flags.StringVar(&cfgFile, "config", "", `Designate the configuration file, in json, yaml or toml format. Defaults to "heimdall_config" with any of those extensions in the current directory, then in your home directory`)
 }
 
-// initConfig reads in config file and ENV variables if set.
+// initConfig reads in the configuration file, if one is named or found
 func initConfig() {
+	if cfgFile == "" {
+		cfgFile = os.Getenv(envName("config"))
+	}
+
 	if cfgFile != "" {
 		// Use config file from the flag.
 		viper.SetConfigFile(cfgFile)
@@ -123,15 +166,21 @@ func initConfig() {
 			os.Exit(1)
 		}
 
-		// Search config in home directory with name ".bifrost" (without extension).
+		// Search for "heimdall_config" in the current then home directory, with any extension viper supports
+		viper.AddConfigPath(".")
 		viper.AddConfigPath(home)
-		viper.SetConfigName(".bifrost")
+		viper.SetConfigName("heimdall_config")
 	}
 
-	viper.AutomaticEnv() // read in environment variables that match
+	err := viper.ReadInConfig()
+	if _, notFound := err.(viper.ConfigFileNotFoundError); notFound && cfgFile == "" {
+		return
+	}
 
-	// If a config file is found, read it in.
-	if err := viper.ReadInConfig(); err == nil {
-		fmt.Println("Using config file:", viper.ConfigFileUsed())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Unable to read config file:", err)
+		os.Exit(1)
 	}
+
+	fmt.Fprintln(os.Stderr, "Using config file:", viper.ConfigFileUsed())
 }
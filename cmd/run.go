@@ -16,10 +16,7 @@ limitations under the License.
 package cmd
 
 import (
-	"encoding/json"
-	"io/ioutil"
 	"log"
-	"time"
 
 	"github.com/dnoberon/heimdall/bifrost"
 	"github.com/spf13/cobra"
@@ -27,41 +24,61 @@ import (
 
 // runCmd represents the run command
 var runCmd = &cobra.Command{
-	Use:   "run",
-	Args:  cobra.NoArgs,
-	Short: `Run heimdall using the "heimdall_config.json" file in the current directory `,
-	Long: `You must first generate a "heimdall_config.json" file before running
+	Use:   "run [job...]",
+	Args:  cobra.ArbitraryArgs,
+	Short: `Run heimdall using the "heimdall_config" file in the current directory`,
+	Long: `You must first generate a "heimdall_config" file before running
 this command. If a file does not already exist please run
-"heimdall init"`,
-	Run: func(cmd *cobra.Command, args []string) {
-		config := bifrost.ManagerConfig{}
+"heimdall init". The file may be written in json, yaml or toml,
+name a different file with --config
+
+A configuration file may describe several named jobs, name the
+jobs to run or run every job with --all. Jobs run as a pipeline,
+a job starts once the jobs it depends on have succeeded and is
+skipped if any of them fail. A job fails when any of its runs
+fails, heimdall then exits with an error
 
-		file, err := ioutil.ReadFile("heimdall_config.json")
+Flags and HEIMDALL_ prefixed environment variables override the
+configuration of every job run`,
+	Run: func(cmd *cobra.Command, args []string) {
+		jobs, err := loadJobs(cmd)
 		if err != nil {
-			log.Fatal(err)
-			return
+			exitInvalid(err)
 		}
 
-		err = json.Unmarshal(file, &config)
+		all, _ := cmd.Flags().GetBool("all")
+
+		jobs, err = bifrost.SelectJobs(jobs, args, all)
 		if err != nil {
 			log.Fatal(err)
 			return
 		}
 
-		timeout, err := time.ParseDuration(config.TimeoutString)
-		if err != nil {
-			log.Fatal(err)
+		if err := bifrost.ValidateJobs(jobs); err != nil {
+			exitInvalid(err)
+		}
+
+		if len(jobs) == 1 {
+			if err := bifrost.Execute(jobs[0].Config); err != nil {
+				log.Fatal(err)
+			}
+
 			return
 		}
 
-		config.Timeout = timeout
-		bifrost.Execute(config)
+		if _, err := bifrost.ExecutePipeline(jobs); err != nil {
+			log.Fatal(err)
+		}
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(runCmd)
 
+	runCmd.Flags().Bool("all", false, "Run every job in the configuration file")
+	addConfigFileFlag(runCmd.Flags())
+	addConfigFlags(runCmd.Flags())
+
 	// Here you will define your flags and configuration settings.
 
 	// Cobra supports Persistent Flags which will work for this command
@@ -0,0 +1,495 @@
+/*
+Copyright © 2019 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/dnoberon/heimdall/bifrost"
+
+	"github.com/go-viper/mapstructure/v2"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// configFlags maps the flags defined by addConfigFlags, and the watch command, to the configuration keys they set
+var configFlags = map[string]string{
+	"repeat":        "Repeat",
+	"timeout":       "TimeoutString",
+	"parallelCount": "InParallelCount",
+
+	"log":          "Log",
+	"logName":      "LogName",
+	"logOverwrite": "LogOverwrite",
+	"logFilter":    "LogFilter",
+	"verbose":      "Verbose",
+
+	"stdin":         "StdinString",
+	"stdinFile":     "StdinFile",
+	"stdinTemplate": "StdinTemplate",
+	"stdinParent":   "StdinParent",
+
+	"env":        "Env",
+	"unsetEnv":   "UnsetEnv",
+	"cleanEnv":   "CleanEnv",
+	"workingDir": "WorkingDir",
+
+	"shellProgram": "Shell",
+
+	"beforeAll":  "Hooks.BeforeAll",
+	"beforeEach": "Hooks.BeforeEach",
+	"afterEach":  "Hooks.AfterEach",
+	"afterAll":   "Hooks.AfterAll",
+
+	"report":      "ReportName",
+	"metricsAddr": "MetricsAddr",
+	"controlAddr": "ControlAddr",
+	"divergence":  "DetectDivergence",
+
+	"every":         "Schedule.Every",
+	"cron":          "Schedule.Cron",
+	"overlap":       "Schedule.Overlap",
+	"scheduleCount": "Schedule.Count",
+	"for":           "For",
+	"until":         "Until",
+	"onDeadline":    "OnDeadline",
+
+	"rampStart":    "Ramp.Start",
+	"rampStep":     "Ramp.Step",
+	"rampInterval": "Ramp.Interval",
+	"rampShape":    "Ramp.Shape",
+
+	"rate": "Rate",
+
+	"maxMemory": "Thresholds.MaxMemory",
+	"maxCPU":    "Thresholds.MaxCPU",
+
+	"limitMemory":    "Limits.Memory",
+	"limitCPUTime":   "Limits.CPUTime",
+	"limitOpenFiles": "Limits.OpenFiles",
+	"limitProcesses": "Limits.Processes",
+	"cgroup":         "Limits.Cgroup",
+	"cgroupParent":   "Limits.CgroupParent",
+	"limitCPUs":      "Limits.CPUs",
+
+	"sample":       "Sampling.Interval",
+	"memoryGrowth": "Sampling.Growth",
+
+	// only defined by the watch command
+	"path":     "Watch.Paths",
+	"debounce": "Watch.Debounce",
+	"build":    "Watch.Build",
+}
+
+// addConfigFlags defines the flags which make up a configuration on the commands running or writing one
+func addConfigFlags(flags *pflag.FlagSet) {
+	flags.IntP("repeat", "r", 1, "Designate how many times to repeat your program with supplied arguments")
+	flags.DurationP("timeout", "t", 0, "Designate when to kill your provided program")
+
+	flags.IntP("parallelCount", "p", 1, "Designate how many instances of your should run in parallel at one time")
+
+	flags.BoolP("log", "l", false, "Toggle logging of provided program's stdout and stderr output to file, appends if file exists")
+	flags.String("logName", "heimdall.log", "Specify the log file name, defaults to heimdall.log")
+	flags.Bool("logOverwrite", false, "Toggle logging of provided program's stdout and stderr output to file")
+	flags.String("logFilter", "", "Allows for log filtering via regex string. Use only valid with log flag")
+	flags.BoolP("verbose", "v", false, "Toggle display of provided program's stdout and stderr output while heimdall runs")
+	flags.String("stdin", "", "Feed the provided string to your program's stdin")
+	flags.String("stdinFile", "", "Feed the contents of a file to your program's stdin")
+	flags.String("stdinTemplate", "", "Feed a file to your program's stdin, rendered per run - e.g input-{{.Repetition}}.txt")
+	flags.String("stdinParent", "", "Feed heimdall's own stdin to your program, either copied to every run (fanout) or split by line across instances (roundrobin)")
+
+	flags.StringArray("env", nil, "Set an environment variable for your program in KEY=VALUE form, may be repeated")
+	flags.StringArray("unsetEnv", nil, "Remove an environment variable from your program's environment, may be repeated")
+	flags.Bool("cleanEnv", false, "Start your program with an empty environment instead of heimdall's own")
+	flags.String("workingDir", "", "Designate the working directory of your program, defaults to the current directory")
+
+	flags.String("shellProgram", "", "Designate the shell and its arguments used by --shell and hooks, defaults to \"sh -c\" or \"cmd /C\" on Windows")
+
+	flags.String("beforeAll", "", "Run a shell command once before your program is first started")
+	flags.String("beforeEach", "", "Run a shell command before every run of your program, a failure fails the run")
+	flags.String("afterEach", "", "Run a shell command after every run of your program, HEIMDALL_EXIT_CODE, HEIMDALL_DURATION and HEIMDALL_LOG_PATH describe the run")
+	flags.String("afterAll", "", "Run a shell command once after every run of your program has finished")
+
+	flags.StringArray("matrix", nil, "Add a matrix axis in name=value1,value2 form, your program runs once per combination of axis values per repetition")
+	flags.String("report", "", "Write a json report of every run's result and the summary to the provided path")
+	flags.String("metricsAddr", "", "Serve Prometheus metrics at /metrics on this address while heimdall runs - e.g :9090")
+	flags.String("controlAddr", "", "Serve the control API on this address while heimdall runs, unix: followed by a socket path - e.g unix:heimdall.sock - or a loopback host:port")
+
+	flags.Bool("divergence", false, "Report how many distinct stdout outputs were produced across runs and diff each outlier against the most common output")
+
+	flags.Duration("every", 0, "Run your program periodically at this interval instead of back to back, one round of instances every time")
+	flags.String("cron", "", "Run your program whenever this cron expression matches instead of back to back - e.g \"*/5 * * * *\" or \"@hourly\"")
+	flags.String("overlap", bifrost.OverlapSkip, "What to do when a scheduled round is due while the previous one still runs - skip, queue, concurrent or kill")
+	flags.Int("scheduleCount", 0, "Stop scheduling after this many rounds were started, no limit by default")
+	flags.Duration("for", 0, "Repeat your program back to back for this long instead of a number of times, or stop scheduling after it")
+	flags.String("until", "", "Repeat your program back to back until this RFC 3339 timestamp instead of a number of times, or stop scheduling at it - e.g 2030-01-02T15:04:05Z")
+	flags.String("onDeadline", bifrost.DeadlineFinish, "What happens to runs still going once --for or --until has passed - finish or kill")
+
+	flags.Int("rampStart", 0, "Start this many instances straight away when ramping, defaults to --rampStep")
+	flags.Int("rampStep", 0, "Ramp up instances gradually, adding this many every --rampInterval until --parallelCount are running")
+	flags.Duration("rampInterval", 0, "How often --rampStep instances are added")
+	flags.StringArray("rampStage", nil, "Add a ramp stage in duration:concurrency form - e.g 1m:10, your program runs at that concurrency for the stage, may be repeated")
+	flags.String("rampShape", bifrost.RampStep, "Whether concurrency jumps to each ramp stage's straight away (step) or moves towards it over the stage (linear)")
+
+	flags.Float64("rate", 0, "Start this many runs per second whether or not earlier runs have finished, --parallelCount caps how many run at once")
+
+	flags.String("maxMemory", "", "Fail a run whose peak resident memory exceeds this size, in bytes or with a K, M or G suffix - e.g 512M")
+	flags.Duration("maxCPU", 0, "Fail a run which used more CPU time than this, user and system together")
+
+	flags.String("limitMemory", "", "Limit the memory your program may use, in bytes or with a K, M or G suffix - e.g 512M, Linux only")
+	flags.Duration("limitCPUTime", 0, "Kill your program once it used this much CPU time, Linux only")
+	flags.Int("limitOpenFiles", 0, "Limit the files your program may hold open, Linux only")
+	flags.Int("limitProcesses", 0, "Limit the processes your user may run at once from your program, or those of the run alone with --cgroup, Linux only")
+	flags.Bool("cgroup", false, "Enforce --limitMemory, --limitProcesses and --limitCPUs through a cgroup v2 per run where available")
+	flags.String("cgroupParent", "", "Create the runs' cgroups below this delegated cgroup, relative to the cgroup v2 mount, defaults to heimdall's own")
+	flags.Float64("limitCPUs", 0, "Limit how many CPUs your program may use at once, requires --cgroup - e.g 0.5")
+
+	flags.Duration("sample", 0, "Sample your program's memory, CPU, threads and open files from /proc at this interval while it runs, Linux only")
+	flags.Float64("memoryGrowth", bifrost.DefaultGrowth, "Flag a sampled run whose memory grew by more than this percentage across the run")
+}
+
+// configDefaults holds the configuration flags as defined by addConfigFlags, never set, for their defaults
+var configDefaults = func() *pflag.FlagSet {
+	flags := pflag.NewFlagSet("defaults", pflag.ContinueOnError)
+	addConfigFlags(flags)
+
+	return flags
+}()
+
+// fileSettings returns the settings of the configuration file read by initConfig with environment variables
+// interpolated, empty if no file was found
+func fileSettings() map[string]interface{} {
+	if viper.ConfigFileUsed() == "" {
+		return map[string]interface{}{}
+	}
+
+	return bifrost.InterpolateSettings(viper.AllSettings())
+}
+
+// jobConfig builds a job's configuration from its settings in the configuration file, environment variables and
+// the command's flags. Flags the user set take precedence over environment variables, which take precedence over
+// the configuration file. Flag defaults are used for anything left unset.
+func jobConfig(cmd *cobra.Command, settings map[string]interface{}) (bifrost.ManagerConfig, error) {
+	config := bifrost.ManagerConfig{}
+
+	v := viper.New()
+	if err := v.MergeConfigMap(settings); err != nil {
+		return config, err
+	}
+
+	for key, names := range configEnv(cmd) {
+		if err := v.BindEnv(append([]string{key}, names...)...); err != nil {
+			return config, err
+		}
+	}
+
+	for name, key := range configFlags {
+		// commands without the configuration flags, such as validate, still use their defaults
+		flag := cmd.Flags().Lookup(name)
+		if flag == nil {
+			flag = configDefaults.Lookup(name)
+		}
+
+		if flag == nil {
+			continue
+		}
+
+		if err := v.BindPFlag(key, flag); err != nil {
+			return config, err
+		}
+	}
+
+	err := v.Unmarshal(&config, viper.DecodeHook(mapstructure.ComposeDecodeHookFunc(
+		mapstructure.StringToTimeDurationHookFunc(),
+		mapstructure.StringToSliceHookFunc(","),
+		mapstructure.TextUnmarshallerHookFunc(),
+	)))
+	if err != nil {
+		return config, decodeErrors(err)
+	}
+
+	if cmd.Flags().Changed("matrix") {
+		rawMatrix, _ := cmd.Flags().GetStringArray("matrix")
+
+		config.Matrix, err = parseMatrix(rawMatrix)
+		if err != nil {
+			return config, err
+		}
+	}
+
+	if cmd.Flags().Changed("rampStage") {
+		rawStages, _ := cmd.Flags().GetStringArray("rampStage")
+
+		config.Ramp.Stages, err = parseStages(rawStages)
+		if err != nil {
+			return config, err
+		}
+	}
+
+	// a program named rather than given by path, e.g "echo", is found as it is on the command line. One that can't
+	// be found is left for validation to report.
+	if config.AbsolutePath != "" {
+		if path, err := bifrost.LookupExecutable(config.AbsolutePath); err == nil {
+			config.AbsolutePath = path
+		}
+	}
+
+	return config, config.Normalize()
+}
+
+// decodeErrors splits an error decoding a configuration into the problems with each field
+func decodeErrors(err error) error {
+	var errs bifrost.ConfigErrors
+
+	var walk func(err error)
+	walk = func(err error) {
+		if decodeErr, ok := err.(*mapstructure.DecodeError); ok {
+			errs = append(errs, &bifrost.FieldError{Field: decodeErr.Name(), Err: decodeErr.Unwrap()})
+			return
+		}
+
+		if joined, ok := err.(interface{ Unwrap() []error }); ok {
+			for _, err := range joined.Unwrap() {
+				walk(err)
+			}
+
+			return
+		}
+
+		if wrapped := errors.Unwrap(err); wrapped != nil {
+			walk(wrapped)
+		}
+	}
+
+	walk(err)
+
+	if len(errs) == 0 {
+		return err
+	}
+
+	return errs
+}
+
+// envName returns the environment variable overriding a flag or configuration key, e.g HEIMDALL_PARALLELCOUNT
+func envName(name string) string {
+	return "HEIMDALL_" + strings.ToUpper(strings.Replace(name, ".", "_", -1))
+}
+
+// configEnv returns the environment variables overriding each configuration key. Every key may be overridden by a
+// variable named after it, e.g HEIMDALL_INPARALLELCOUNT or HEIMDALL_HOOKS_BEFOREALL, and keys set by a flag also by
+// a variable named after the flag, e.g HEIMDALL_PARALLELCOUNT. A key's own variable is dropped when it would clash
+// with another flag's, as HEIMDALL_SHELL does.
+func configEnv(cmd *cobra.Command) map[string][]string {
+	flags := map[string]string{}
+	for _, flagSet := range []*pflag.FlagSet{cmd.Root().Flags(), cmd.Flags()} {
+		flagSet.VisitAll(func(flag *pflag.Flag) {
+			flags[envName(flag.Name)] = flag.Name
+		})
+	}
+
+	env := map[string][]string{}
+	for _, key := range configKeys(reflect.TypeOf(bifrost.ManagerConfig{}), "") {
+		if flag, ok := flags[envName(key)]; !ok || strings.EqualFold(configFlags[flag], key) {
+			env[key] = append(env[key], envName(key))
+		}
+	}
+
+	for flag, key := range configFlags {
+		if name := envName(flag); name != envName(key) {
+			env[key] = append(env[key], name)
+		}
+	}
+
+	return env
+}
+
+// configKeys lists the keys of every field of a configuration which can be set from a single string. Fields holding
+// structured values, such as Matrix or Ramp.Stages, are left out.
+func configKeys(t reflect.Type, prefix string) []string {
+	var keys []string
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Tag.Get("json") == "-" {
+			continue
+		}
+
+		switch {
+		case field.Type.Kind() == reflect.Struct:
+			keys = append(keys, configKeys(field.Type, prefix+field.Name+".")...)
+		case field.Type.Kind() == reflect.Ptr && !field.Type.Implements(textUnmarshaler):
+			continue
+		case field.Type.Kind() == reflect.Slice && field.Type.Elem().Kind() == reflect.Struct:
+			continue
+		default:
+			keys = append(keys, prefix+field.Name)
+		}
+	}
+
+	return keys
+}
+
+var textUnmarshaler = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// flagsFromEnv sets every flag the user left unset, and which doesn't set a configuration key, from its environment
+// variable. Flags holding lists, such as --matrix, take whitespace separated values.
+func flagsFromEnv(flags *pflag.FlagSet) error {
+	var err error
+
+	flags.VisitAll(func(flag *pflag.Flag) {
+		if _, ok := configFlags[flag.Name]; ok || flag.Changed || err != nil {
+			return
+		}
+
+		value, ok := os.LookupEnv(envName(flag.Name))
+		if !ok {
+			return
+		}
+
+		if list, isList := flag.Value.(pflag.SliceValue); isList {
+			err = list.Replace(strings.Fields(value))
+		} else {
+			err = flag.Value.Set(value)
+		}
+
+		if err != nil {
+			err = fmt.Errorf("invalid %s: %s", envName(flag.Name), err)
+			return
+		}
+
+		flag.Changed = true
+	})
+
+	return err
+}
+
+// loadJobs builds the configuration of every job in the configuration file. Problems decoding a job are reported
+// together as a bifrost.ConfigErrors, the jobs are still returned with every field that could be decoded.
+func loadJobs(cmd *cobra.Command) ([]bifrost.Job, error) {
+	if viper.ConfigFileUsed() == "" {
+		return nil, errors.New(`no configuration file found, please run "heimdall init" or name one with --config`)
+	}
+
+	settings, err := bifrost.SplitJobs(fileSettings())
+	if err != nil {
+		return nil, err
+	}
+
+	var errs bifrost.ConfigErrors
+
+	jobs := make([]bifrost.Job, 0, len(settings))
+	for _, job := range settings {
+		config, err := jobConfig(cmd, job.Settings)
+		if err != nil {
+			errs = append(errs, jobErrors(job.Name, len(settings), err)...)
+		}
+
+		jobs = append(jobs, bifrost.Job{Name: job.Name, Config: config})
+	}
+
+	if len(errs) > 0 {
+		return jobs, errs
+	}
+
+	return jobs, nil
+}
+
+// jobErrors places the problems building a job's configuration under the job's field path
+func jobErrors(name string, jobs int, err error) bifrost.ConfigErrors {
+	prefix := ""
+	if jobs > 1 || name != bifrost.DefaultJob {
+		prefix = "Jobs." + name
+	}
+
+	var errs bifrost.ConfigErrors
+	switch err := err.(type) {
+	case bifrost.ConfigErrors:
+		errs = err
+	case *bifrost.FieldError:
+		errs = bifrost.ConfigErrors{err}
+	default:
+		errs = bifrost.ConfigErrors{{Err: err}}
+	}
+
+	placed := make(bifrost.ConfigErrors, len(errs))
+	for i, fieldErr := range errs {
+		field := strings.Trim(prefix+"."+fieldErr.Field, ".")
+		if field == "" {
+			field = "configuration"
+		}
+
+		placed[i] = &bifrost.FieldError{Field: field, Err: fieldErr.Err}
+	}
+
+	return placed
+}
+
+// exitInvalid reports every problem with a configuration and exits
+func exitInvalid(err error) {
+	errs, ok := err.(bifrost.ConfigErrors)
+	if !ok {
+		log.Fatal(err)
+	}
+
+	fmt.Fprintf(os.Stderr, "heimdall: invalid configuration, %d problem(s) found\n", len(errs))
+	for _, fieldErr := range errs {
+		fmt.Fprintf(os.Stderr, "  %s\n", fieldErr)
+	}
+
+	os.Exit(1)
+}
+
+// parseStages builds ramp stages from stages in duration:concurrency form
+func parseStages(stages []string) ([]bifrost.RampStage, error) {
+	var parsed []bifrost.RampStage
+
+	for _, stage := range stages {
+		parts := strings.SplitN(stage, ":", 2)
+
+		concurrency, err := strconv.Atoi(parts[len(parts)-1])
+		if len(parts) != 2 || parts[0] == "" || err != nil {
+			return nil, &bifrost.FieldError{Field: "Ramp.Stages", Err: fmt.Errorf("invalid stage %q, expected duration:concurrency", stage)}
+		}
+
+		parsed = append(parsed, bifrost.RampStage{Duration: parts[0], Concurrency: concurrency})
+	}
+
+	return parsed, nil
+}
+
+// parseMatrix builds a matrix from axes in name=value1,value2 form
+func parseMatrix(axes []string) (*bifrost.Matrix, error) {
+	matrix := &bifrost.Matrix{}
+
+	for _, axis := range axes {
+		parts := strings.SplitN(axis, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid matrix axis %q, expected name=value1,value2", axis)
+		}
+
+		matrix.Axes = append(matrix.Axes, bifrost.MatrixAxis{Name: parts[0], Values: strings.Split(parts[1], ",")})
+	}
+
+	return matrix, nil
+}
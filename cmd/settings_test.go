@@ -0,0 +1,105 @@
+/*
+Copyright © 2019 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dnoberon/heimdall/bifrost"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+// readConfig has viper read a configuration file holding content, as initConfig would
+func readConfig(t *testing.T, name, content string) {
+	path := filepath.Join(t.TempDir(), name)
+	assert.Nil(t, ioutil.WriteFile(path, []byte(content), 0644))
+
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+
+	viper.SetConfigFile(path)
+	assert.Nil(t, viper.ReadInConfig())
+}
+
+func TestLoadJobsSingleProgram(t *testing.T) {
+	readConfig(t, "heimdall_config.json", `{"AbsolutePath": "/bin/tool", "TimeoutString": "1m", "Repeat": 2, "LogFilter": "err.*"}`)
+
+	jobs, err := loadJobs(&cobra.Command{})
+	assert.Nil(t, err)
+	assert.Len(t, jobs, 1)
+
+	assert.Equal(t, bifrost.DefaultJob, jobs[0].Name)
+	assert.Equal(t, time.Minute, jobs[0].Config.Timeout)
+	assert.Equal(t, 2, jobs[0].Config.Repeat)
+	assert.True(t, jobs[0].Config.LogFilter.MatchString("error"))
+
+	// fields the file leaves out take the flags' defaults
+	assert.Equal(t, 1, jobs[0].Config.InParallelCount)
+}
+
+func TestLoadJobsProgramName(t *testing.T) {
+	readConfig(t, "heimdall_config.json", `{"AbsolutePath": "sh"}`)
+
+	jobs, err := loadJobs(&cobra.Command{})
+	assert.Nil(t, err)
+
+	// a program named in the configuration is found on the PATH as it would be on the command line
+	path, _ := exec.LookPath("sh")
+	assert.Equal(t, path, jobs[0].Config.AbsolutePath)
+	assert.Nil(t, bifrost.ValidateJobs(jobs))
+}
+
+func TestLoadJobsInheritDefaults(t *testing.T) {
+	t.Setenv("TOOL", "/bin/tool")
+
+	readConfig(t, "heimdall_config.yaml", `
+defaults:
+  absolutePath: ${TOOL}
+  repeat: 5
+  matrix:
+    axes:
+      - name: size
+        values: ["1"]
+jobs:
+  smoke:
+    repeat: 1
+  soak:
+    timeoutString: 1h
+    matrix:
+      exclude:
+        - size: "1"
+`)
+
+	jobs, err := loadJobs(&cobra.Command{})
+	assert.Nil(t, err)
+	assert.Len(t, jobs, 2)
+
+	smoke, soak := jobs[0].Config, jobs[1].Config
+	assert.Equal(t, "soak", jobs[1].Name)
+
+	assert.Equal(t, 1, smoke.Repeat)
+	assert.Equal(t, "/bin/tool", smoke.AbsolutePath)
+	assert.Equal(t, 5, soak.Repeat)
+	assert.Equal(t, time.Hour, soak.Timeout)
+	assert.Len(t, soak.Matrix.Axes, 1)
+	assert.Len(t, soak.Matrix.Exclude, 1)
+}
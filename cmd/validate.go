@@ -0,0 +1,88 @@
+/*
+Copyright © 2019 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/dnoberon/heimdall/bifrost"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// validateCmd represents the validate command
+var validateCmd = &cobra.Command{
+	Use:   "validate [config]",
+	Args:  cobra.MaximumNArgs(1),
+	Short: "Check a configuration file without running anything",
+	Long: `Validate checks every job of a configuration file, defaulting to
+the "heimdall_config" file heimdall would otherwise use. The
+executable must exist and be executable, durations must parse,
+regular expressions and templates must compile, counts must be
+positive and the log and report paths must be writable.
+
+Every problem found is reported along with the path of the field
+at fault, e.g Jobs.soak.TimeoutString`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) == 1 {
+			viper.SetConfigFile(args[0])
+
+			if err := viper.ReadInConfig(); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		jobs, err := loadJobs(cmd)
+		if _, ok := err.(bifrost.ConfigErrors); err != nil && !ok {
+			log.Fatal(err)
+		}
+
+		errs, _ := err.(bifrost.ConfigErrors)
+		if err, ok := bifrost.ValidateJobs(jobs).(bifrost.ConfigErrors); ok {
+			errs = appendProblems(errs, err)
+		}
+
+		if len(errs) > 0 {
+			exitInvalid(errs)
+		}
+
+		fmt.Printf("heimdall: %s is valid, %d job(s) checked\n", viper.ConfigFileUsed(), len(jobs))
+	},
+}
+
+// appendProblems adds the problems with every field not already reported on, as a field that failed to decode is
+// likely to fail validation as well
+func appendProblems(errs, more bifrost.ConfigErrors) bifrost.ConfigErrors {
+	reported := map[string]bool{}
+	for _, err := range errs {
+		reported[err.Field] = true
+	}
+
+	for _, err := range more {
+		if !reported[err.Field] {
+			errs = append(errs, err)
+		}
+	}
+
+	return errs
+}
+
+func init() {
+	rootCmd.AddCommand(validateCmd)
+
+	addConfigFileFlag(validateCmd.Flags())
+}
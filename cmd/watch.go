@@ -0,0 +1,58 @@
+/*
+Copyright © 2019 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"log"
+	"time"
+
+	"github.com/dnoberon/heimdall/bifrost"
+	"github.com/spf13/cobra"
+)
+
+// watchCmd represents the watch command
+var watchCmd = &cobra.Command{
+	Use:   "watch [program [arguments...]]",
+	Short: "Run your program again every time a watched file changes",
+	Long: `Watch runs your program, then runs it again every time a file
+matching one of the watched paths changes. Paths are files,
+directories or globs, "**" matching any number of directories -
+e.g --path="src/**/*.go". The current directory is watched by
+default.
+
+Changes are debounced, a run still going when a change is seen is
+killed and --build runs before the program every time. Without a
+program the configuration file's is run, every other flag works
+as it does when heimdall runs your program directly`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := commandConfig(cmd, args)
+
+		if err := bifrost.Watch(config); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(watchCmd)
+
+	watchCmd.Flags().Bool("shell", false, "Run the provided command through a shell, allowing pipelines and compound commands")
+	watchCmd.Flags().StringArray("path", nil, `Watch a file, directory or glob for changes - e.g "src/**/*.go", may be repeated`)
+	watchCmd.Flags().Duration("debounce", 200*time.Millisecond, "Wait for changes to settle for this long before restarting your program")
+	watchCmd.Flags().String("build", "", "Run a shell command every time before your program is started, your program isn't started when it fails - e.g \"go build -o bin/tool .\"")
+	addConfigFileFlag(watchCmd.Flags())
+	addConfigFlags(watchCmd.Flags())
+}